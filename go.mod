@@ -4,13 +4,14 @@ go 1.15
 
 require (
 	cloud.google.com/go v0.70.0 // indirect
-	github.com/golang/protobuf v1.4.3
-	github.com/hashicorp/waypoint-plugin-sdk v0.0.0-20201021094150-1b1044b1478e
+	github.com/golang/protobuf v1.5.2
+	github.com/hashicorp/go-multierror v1.1.0
+	github.com/hashicorp/waypoint-plugin-sdk v0.0.0-20210609145036-5c5b44751ee6
 	github.com/sharkyze/waypoint-plugin-cloudstorage v0.0.0-20201021192251-388457b50efd
 	golang.org/x/net v0.0.0-20201021035429-f5854403a974 // indirect
 	golang.org/x/sys v0.0.0-20201020230747-6e5568b54d1a // indirect
 	google.golang.org/api v0.33.0
 	google.golang.org/appengine v1.6.7 // indirect
-	google.golang.org/grpc v1.33.1 // indirect
-	google.golang.org/protobuf v1.25.0
+	google.golang.org/grpc v1.33.1
+	google.golang.org/protobuf v1.26.0
 )
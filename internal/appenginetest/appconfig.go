@@ -0,0 +1,108 @@
+package appenginetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"google.golang.org/api/cloudscheduler/v1"
+	"google.golang.org/api/cloudtasks/v2"
+)
+
+// Job returns the Cloud Scheduler job with the given full name, or nil if it
+// does not exist.
+func (s *Server) Job(name string) *cloudscheduler.Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.jobs[name]
+}
+
+// Queue returns the Cloud Tasks queue with the given full name, or nil if it
+// does not exist.
+func (s *Server) Queue(name string) *cloudtasks.Queue {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.queues[name]
+}
+
+// serveJob serves the Cloud Scheduler jobs of a location: jobs are created
+// with a POST on the collection and replaced with a PATCH.
+func (s *Server) serveJob(w http.ResponseWriter, r *http.Request, segs []string) {
+	var job cloudscheduler.Job
+	if err := json.NewDecoder(r.Body).Decode(&job); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+
+	name := strings.Join(segs, "/")
+
+	switch {
+	case r.Method == http.MethodPost && len(segs) == 5:
+		if !strings.HasPrefix(job.Name, name+"/") {
+			writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Job name outside of "+name)
+			return
+		}
+
+		if _, ok := s.jobs[job.Name]; ok {
+			writeError(w, http.StatusConflict, "ALREADY_EXISTS", "Job already exists: "+job.Name)
+			return
+		}
+	case r.Method == http.MethodPatch && len(segs) == 6:
+		if _, ok := s.jobs[name]; !ok {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Job not found: "+name)
+			return
+		}
+
+		job.Name = name
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Unknown path "+r.URL.Path)
+		return
+	}
+
+	job.State = "ENABLED"
+	s.jobs[job.Name] = &job
+
+	writeJSON(w, &job)
+}
+
+// serveQueue serves the Cloud Tasks queues of a location: queues are
+// created with a POST on the collection and replaced with a PATCH.
+func (s *Server) serveQueue(w http.ResponseWriter, r *http.Request, segs []string) {
+	var q cloudtasks.Queue
+	if err := json.NewDecoder(r.Body).Decode(&q); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+
+	name := strings.Join(segs, "/")
+
+	switch {
+	case r.Method == http.MethodPost && len(segs) == 5:
+		if !strings.HasPrefix(q.Name, name+"/") {
+			writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Queue name outside of "+name)
+			return
+		}
+
+		if _, ok := s.queues[q.Name]; ok {
+			writeError(w, http.StatusConflict, "ALREADY_EXISTS", "Queue already exists: "+q.Name)
+			return
+		}
+	case r.Method == http.MethodPatch && len(segs) == 6:
+		if _, ok := s.queues[name]; !ok {
+			writeError(w, http.StatusNotFound, "NOT_FOUND", "Queue not found: "+name)
+			return
+		}
+
+		q.Name = name
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Unknown path "+r.URL.Path)
+		return
+	}
+
+	q.State = "RUNNING"
+	s.queues[q.Name] = &q
+
+	writeJSON(w, &q)
+}
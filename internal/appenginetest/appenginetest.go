@@ -0,0 +1,742 @@
+// Package appenginetest provides an in-memory fake of the App Engine Admin
+// API, served over HTTP, to test the plugin components offline.
+//
+// The fake covers the applications, services, versions, instances and
+// operations calls the plugin makes, along with the Cloud Storage and Cloud
+// Resource Manager calls around the artifact, the Cloud Build calls around
+// the build logs of a version and the Cloud Scheduler and Cloud Tasks calls
+// applying cron jobs and queues. Mutations return
+// operations which finish after OperationPolls polls, the change is only
+// visible once the operation is done.
+//
+// MockClient is a lighter alternative to unit test a single function
+// against given API responses.
+package appenginetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/cloudbuild/v1"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/cloudscheduler/v1"
+	"google.golang.org/api/cloudtasks/v2"
+	"google.golang.org/api/option"
+	"google.golang.org/api/storage/v1"
+)
+
+// Server is a fake App Engine Admin API server.
+type Server struct {
+	// URL is the base URL of the server.
+	URL string
+
+	// OperationPolls is the number of polls after which an operation is
+	// done. Operations are done as soon as they are created when zero.
+	OperationPolls int
+
+	srv *httptest.Server
+
+	mu         sync.Mutex
+	services   map[string]*appengine.Service
+	versions   map[string]*appengine.Version
+	instances  map[string]*appengine.Instance
+	operations map[string]*operation
+	failures   map[string]string
+	objects    map[string]*object
+	policies   map[string]*storage.Policy
+	projects   map[string]int64
+	jobs       map[string]*cloudscheduler.Job
+	queues     map[string]*cloudtasks.Queue
+	builds     map[string]*cloudbuild.Build
+	buildLogs  map[string][]string
+	requests   []string
+	nextOpID   int
+}
+
+// operation is a pending mutation. Progress, if set, is called on every
+// poll before the operation is done.
+type operation struct {
+	op       *appengine.Operation
+	polls    int
+	apply    func() (interface{}, *appengine.Status)
+	progress func()
+}
+
+// NewServer starts a fake server. It must be closed once done.
+func NewServer() *Server {
+	s := &Server{
+		services:   map[string]*appengine.Service{},
+		versions:   map[string]*appengine.Version{},
+		instances:  map[string]*appengine.Instance{},
+		operations: map[string]*operation{},
+		failures:   map[string]string{},
+		objects:    map[string]*object{},
+		policies:   map[string]*storage.Policy{},
+		projects:   map[string]int64{},
+		jobs:       map[string]*cloudscheduler.Job{},
+		queues:     map[string]*cloudtasks.Queue{},
+		builds:     map[string]*cloudbuild.Build{},
+		buildLogs:  map[string][]string{},
+	}
+
+	s.srv = httptest.NewServer(s)
+	s.URL = s.srv.URL
+
+	return s
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// ClientOptions returns the options pointing a Google API client to the
+// fake server, without authentication.
+func (s *Server) ClientOptions() []option.ClientOption {
+	return []option.ClientOption{
+		option.WithEndpoint(s.URL + "/"),
+		option.WithHTTPClient(s.srv.Client()),
+	}
+}
+
+// AddVersion adds a version to a service, creating the service if it does
+// not exist yet. The first version of a service receives all its traffic.
+func (s *Server) AddVersion(project, service string, v *appengine.Version) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.createVersion(project, service, v)
+}
+
+// AddInstance adds an instance to a version.
+func (s *Server) AddInstance(project, service, versionID, instanceID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := versionName(project, service, versionID) + "/instances/" + instanceID
+	s.instances[name] = &appengine.Instance{
+		Id:           instanceID,
+		Name:         name,
+		StartTime:    time.Now().UTC().Format(time.RFC3339),
+		VmStatus:     "RUNNING",
+		Availability: "DYNAMIC",
+	}
+}
+
+// SetProjectNumber sets the number of a project. Projects with no number
+// are not found.
+func (s *Server) SetProjectNumber(project string, number int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.projects[project] = number
+}
+
+// FailBuilds makes the creation of the versions of the service fail once
+// their operation is done, as if their build failed.
+func (s *Server) FailBuilds(project, service, message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failures[serviceName(project, service)] = message
+}
+
+// Service returns a copy of the service, or nil if it does not exist.
+func (s *Server) Service(project, service string) *appengine.Service {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	aes, ok := s.services[serviceName(project, service)]
+	if !ok {
+		return nil
+	}
+
+	c := *aes
+	if aes.Split != nil {
+		c.Split = &appengine.TrafficSplit{ShardBy: aes.Split.ShardBy, Allocations: map[string]float64{}}
+		for k, v := range aes.Split.Allocations {
+			c.Split.Allocations[k] = v
+		}
+	}
+
+	return &c
+}
+
+// Version returns a copy of the version, or nil if it does not exist.
+func (s *Server) Version(project, service, versionID string) *appengine.Version {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.versions[versionName(project, service, versionID)]
+	if !ok {
+		return nil
+	}
+
+	c := *v
+
+	return &c
+}
+
+// Versions returns the ids of the versions of the service, sorted.
+func (s *Server) Versions(project, service string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var ids []string
+
+	for _, v := range s.serviceVersions(serviceName(project, service)) {
+		ids = append(ids, v.Id)
+	}
+
+	return ids
+}
+
+// Requests returns the requests served so far, as "METHOD path".
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]string(nil), s.requests...)
+}
+
+// ServeHTTP implements http.Handler.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	segs := strings.Split(strings.Trim(r.URL.EscapedPath(), "/"), "/")
+	for i, seg := range segs {
+		if unescaped, err := url.PathUnescape(seg); err == nil {
+			segs[i] = unescaped
+		}
+	}
+
+	switch {
+	case len(segs) >= 3 && segs[0] == "v1" && segs[1] == "apps":
+		s.serveApp(w, r, segs[2], segs[3:])
+	case len(segs) == 3 && segs[0] == "v1" && segs[1] == "projects":
+		s.serveProject(w, r, segs[2])
+	case len(segs) == 5 && segs[0] == "v1" && segs[1] == "projects" && segs[3] == "builds":
+		s.serveBuild(w, r, segs[2], segs[4])
+	case len(segs) >= 6 && segs[0] == "v1" && segs[1] == "projects" && segs[5] == "jobs":
+		s.serveJob(w, r, segs[1:])
+	case len(segs) >= 6 && segs[0] == "v2" && segs[1] == "projects" && segs[5] == "queues":
+		s.serveQueue(w, r, segs[1:])
+	case len(segs) == 3 && segs[0] == "b" && segs[2] == "iam":
+		s.serveBucketIAM(w, r, segs[1])
+	case len(segs) == 3 && segs[0] == "b" && segs[2] == "o":
+		s.listObjects(w, r, segs[1])
+	case len(segs) == 4 && segs[0] == "b" && segs[2] == "o":
+		s.serveObject(w, r, segs[1], segs[3])
+	case len(segs) == 6 && segs[0] == "upload" && segs[3] == "b" && segs[5] == "o":
+		s.serveUpload(w, r, segs[4])
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Unknown path "+r.URL.Path)
+	}
+}
+
+func (s *Server) serveApp(w http.ResponseWriter, r *http.Request, project string, segs []string) {
+	route := make([]string, len(segs))
+	for i, seg := range segs {
+		// Even segments are collections, odd segments are ids.
+		if i%2 == 0 {
+			route[i] = seg
+		} else {
+			route[i] = "*"
+		}
+	}
+
+	switch r.Method + " " + strings.Join(route, "/") {
+	case "GET ":
+		writeJSON(w, &appengine.Application{
+			Id:              project,
+			Name:            "apps/" + project,
+			LocationId:      "us-central",
+			DefaultHostname: project + ".appspot.com",
+			CodeBucket:      "staging." + project + ".appspot.com",
+			DefaultBucket:   project + ".appspot.com",
+			ServingStatus:   "SERVING",
+		})
+	case "GET operations/*":
+		s.getOperation(w, project, segs[1])
+	case "GET services":
+		s.listServices(w, project)
+	case "GET services/*":
+		s.getService(w, project, segs[1])
+	case "PATCH services/*":
+		s.patchService(w, r, project, segs[1])
+	case "DELETE services/*":
+		s.deleteService(w, project, segs[1])
+	case "GET services/*/versions":
+		s.listVersions(w, project, segs[1])
+	case "POST services/*/versions":
+		s.postVersion(w, r, project, segs[1])
+	case "GET services/*/versions/*":
+		s.getVersion(w, project, segs[1], segs[3])
+	case "PATCH services/*/versions/*":
+		s.patchVersion(w, r, project, segs[1], segs[3])
+	case "DELETE services/*/versions/*":
+		s.deleteVersion(w, project, segs[1], segs[3])
+	case "GET services/*/versions/*/instances":
+		s.listInstances(w, project, segs[1], segs[3])
+	case "GET services/*/versions/*/instances/*":
+		s.getInstance(w, project, segs[1], segs[3], segs[5])
+	case "DELETE services/*/versions/*/instances/*":
+		s.deleteInstance(w, project, segs[1], segs[3], segs[5])
+	default:
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Unknown path "+r.URL.Path)
+	}
+}
+
+func (s *Server) serveProject(w http.ResponseWriter, r *http.Request, project string) {
+	number, ok := s.projects[project]
+	if r.Method != http.MethodGet || !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Project not found: "+project)
+		return
+	}
+
+	writeJSON(w, &cloudresourcemanager.Project{
+		ProjectId:      project,
+		ProjectNumber:  number,
+		LifecycleState: "ACTIVE",
+	})
+}
+
+func (s *Server) getOperation(w http.ResponseWriter, project, id string) {
+	o, ok := s.operations["apps/"+project+"/operations/"+id]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Operation not found")
+		return
+	}
+
+	if !o.op.Done {
+		o.polls++
+		if o.progress != nil {
+			o.progress()
+		}
+
+		if o.polls >= s.OperationPolls {
+			s.finish(o)
+		}
+	}
+
+	writeJSON(w, o.op)
+}
+
+func (s *Server) listServices(w http.ResponseWriter, project string) {
+	prefix := "apps/" + project + "/services/"
+
+	var names []string
+
+	for name := range s.services {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	resp := &appengine.ListServicesResponse{}
+	for _, name := range names {
+		resp.Services = append(resp.Services, s.services[name])
+	}
+
+	writeJSON(w, resp)
+}
+
+func (s *Server) getService(w http.ResponseWriter, project, service string) {
+	aes, ok := s.services[serviceName(project, service)]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Service not found: "+service)
+		return
+	}
+
+	writeJSON(w, aes)
+}
+
+func (s *Server) patchService(w http.ResponseWriter, r *http.Request, project, service string) {
+	name := serviceName(project, service)
+
+	aes, ok := s.services[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Service not found: "+service)
+		return
+	}
+
+	var patch appengine.Service
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+
+	if r.URL.Query().Get("updateMask") != "split" || patch.Split == nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Only the split can be updated")
+		return
+	}
+
+	var total float64
+
+	for versionID, share := range patch.Split.Allocations {
+		if _, ok := s.versions[name+"/versions/"+versionID]; !ok {
+			writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Version not found: "+versionID)
+			return
+		}
+
+		total += share
+	}
+
+	if total < 0.999 || total > 1.001 {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Traffic allocations should sum to 1")
+		return
+	}
+
+	op := s.startOperation(project, "google.appengine.v1.Services.UpdateService", name, func() (interface{}, *appengine.Status) {
+		aes.Split = patch.Split
+		return aes, nil
+	})
+
+	writeJSON(w, op)
+}
+
+func (s *Server) deleteService(w http.ResponseWriter, project, service string) {
+	name := serviceName(project, service)
+
+	if _, ok := s.services[name]; !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Service not found: "+service)
+		return
+	}
+
+	if service == "default" {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "The default service cannot be deleted")
+		return
+	}
+
+	op := s.startOperation(project, "google.appengine.v1.Services.DeleteService", name, func() (interface{}, *appengine.Status) {
+		for _, v := range s.serviceVersions(name) {
+			s.removeVersion(v.Name)
+		}
+
+		delete(s.services, name)
+
+		return nil, nil
+	})
+
+	writeJSON(w, op)
+}
+
+func (s *Server) listVersions(w http.ResponseWriter, project, service string) {
+	name := serviceName(project, service)
+
+	if _, ok := s.services[name]; !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Service not found: "+service)
+		return
+	}
+
+	writeJSON(w, &appengine.ListVersionsResponse{Versions: s.serviceVersions(name)})
+}
+
+func (s *Server) postVersion(w http.ResponseWriter, r *http.Request, project, service string) {
+	var v appengine.Version
+	if err := json.NewDecoder(r.Body).Decode(&v); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+
+	if v.Id == "" || v.Runtime == "" {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Version id and runtime should not be empty")
+		return
+	}
+
+	name := versionName(project, service, v.Id)
+
+	if _, ok := s.versions[name]; ok {
+		writeError(w, http.StatusConflict, "ALREADY_EXISTS", "Version already exists: "+v.Id)
+		return
+	}
+
+	b := s.startBuild(project, service)
+
+	op := s.startOperation(project, "google.appengine.v1.Versions.CreateVersion", name, func() (interface{}, *appengine.Status) {
+		message, failed := s.failures[serviceName(project, service)]
+		s.finishBuild(b, failed)
+
+		if failed {
+			// The version exists even though its build failed, but it
+			// does not receive traffic.
+			v.ServingStatus = "STOPPED"
+			if _, ok := s.services[serviceName(project, service)]; !ok {
+				s.services[serviceName(project, service)] = &appengine.Service{
+					Id:    service,
+					Name:  serviceName(project, service),
+					Split: &appengine.TrafficSplit{Allocations: map[string]float64{}},
+				}
+			}
+
+			s.createVersion(project, service, &v)
+
+			return nil, &appengine.Status{Code: 9, Message: message}
+		}
+
+		return s.createVersion(project, service, &v), nil
+	})
+
+	s.attachBuild(op, b)
+
+	writeJSON(w, op)
+}
+
+func (s *Server) getVersion(w http.ResponseWriter, project, service, versionID string) {
+	v, ok := s.versions[versionName(project, service, versionID)]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Version not found: "+versionID)
+		return
+	}
+
+	writeJSON(w, v)
+}
+
+func (s *Server) patchVersion(w http.ResponseWriter, r *http.Request, project, service, versionID string) {
+	name := versionName(project, service, versionID)
+
+	v, ok := s.versions[name]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Version not found: "+versionID)
+		return
+	}
+
+	var patch appengine.Version
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+
+	if r.URL.Query().Get("updateMask") != "servingStatus" {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Only the serving status can be updated")
+		return
+	}
+
+	if patch.ServingStatus != "SERVING" && patch.ServingStatus != "STOPPED" {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Invalid serving status: "+patch.ServingStatus)
+		return
+	}
+
+	op := s.startOperation(project, "google.appengine.v1.Versions.UpdateVersion", name, func() (interface{}, *appengine.Status) {
+		v.ServingStatus = patch.ServingStatus
+		return v, nil
+	})
+
+	writeJSON(w, op)
+}
+
+func (s *Server) deleteVersion(w http.ResponseWriter, project, service, versionID string) {
+	name := versionName(project, service, versionID)
+
+	if _, ok := s.versions[name]; !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Version not found: "+versionID)
+		return
+	}
+
+	aes := s.services[serviceName(project, service)]
+	if aes.Split != nil && aes.Split.Allocations[versionID] > 0 {
+		writeError(
+			w, http.StatusBadRequest, "FAILED_PRECONDITION",
+			"Cannot delete a version with a non-zero traffic allocation",
+		)
+		return
+	}
+
+	op := s.startOperation(project, "google.appengine.v1.Versions.DeleteVersion", name, func() (interface{}, *appengine.Status) {
+		s.removeVersion(name)
+		return nil, nil
+	})
+
+	writeJSON(w, op)
+}
+
+func (s *Server) listInstances(w http.ResponseWriter, project, service, versionID string) {
+	name := versionName(project, service, versionID)
+
+	if _, ok := s.versions[name]; !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Version not found: "+versionID)
+		return
+	}
+
+	var names []string
+
+	for n := range s.instances {
+		if strings.HasPrefix(n, name+"/instances/") {
+			names = append(names, n)
+		}
+	}
+
+	sort.Strings(names)
+
+	resp := &appengine.ListInstancesResponse{}
+	for _, n := range names {
+		resp.Instances = append(resp.Instances, s.instances[n])
+	}
+
+	writeJSON(w, resp)
+}
+
+func (s *Server) getInstance(w http.ResponseWriter, project, service, versionID, instanceID string) {
+	i, ok := s.instances[versionName(project, service, versionID)+"/instances/"+instanceID]
+	if !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Instance not found: "+instanceID)
+		return
+	}
+
+	writeJSON(w, i)
+}
+
+func (s *Server) deleteInstance(w http.ResponseWriter, project, service, versionID, instanceID string) {
+	name := versionName(project, service, versionID) + "/instances/" + instanceID
+
+	if _, ok := s.instances[name]; !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Instance not found: "+instanceID)
+		return
+	}
+
+	op := s.startOperation(project, "google.appengine.v1.Instances.DeleteInstance", name, func() (interface{}, *appengine.Status) {
+		delete(s.instances, name)
+		return nil, nil
+	})
+
+	writeJSON(w, op)
+}
+
+// startOperation registers a mutation, applied once the operation is done.
+func (s *Server) startOperation(
+	project, method, target string,
+	apply func() (interface{}, *appengine.Status),
+) *appengine.Operation {
+	s.nextOpID++
+
+	md, _ := json.Marshal(&appengine.OperationMetadataV1{
+		Method:     method,
+		Target:     target,
+		InsertTime: time.Now().UTC().Format(time.RFC3339),
+	})
+
+	o := &operation{
+		op: &appengine.Operation{
+			Name:     "apps/" + project + "/operations/" + strconv.Itoa(s.nextOpID),
+			Metadata: md,
+		},
+		apply: apply,
+	}
+
+	s.operations[o.op.Name] = o
+
+	if s.OperationPolls == 0 {
+		s.finish(o)
+	}
+
+	return o.op
+}
+
+// finish applies the mutation of the operation and marks it as done.
+func (s *Server) finish(o *operation) {
+	resp, status := o.apply()
+
+	o.op.Done = true
+
+	if status != nil {
+		o.op.Error = status
+		return
+	}
+
+	if resp != nil {
+		o.op.Response, _ = json.Marshal(resp)
+	}
+}
+
+// createVersion stores the version with its output only fields set.
+func (s *Server) createVersion(project, service string, v *appengine.Version) *appengine.Version {
+	sn := serviceName(project, service)
+
+	c := *v
+	c.Name = versionName(project, service, v.Id)
+	c.CreateTime = time.Now().UTC().Format(time.RFC3339)
+	c.CreatedBy = "appenginetest@example.com"
+	c.VersionUrl = "https://" + v.Id + "-dot-" + service + "-dot-" + project + ".appspot.com"
+
+	if c.ServingStatus == "" {
+		c.ServingStatus = "SERVING"
+	}
+
+	s.versions[c.Name] = &c
+
+	if _, ok := s.services[sn]; !ok {
+		s.services[sn] = &appengine.Service{
+			Id:    service,
+			Name:  sn,
+			Split: &appengine.TrafficSplit{Allocations: map[string]float64{v.Id: 1}},
+		}
+	}
+
+	return &c
+}
+
+// removeVersion deletes the version and its instances.
+func (s *Server) removeVersion(name string) {
+	delete(s.versions, name)
+
+	for n := range s.instances {
+		if strings.HasPrefix(n, name+"/instances/") {
+			delete(s.instances, n)
+		}
+	}
+}
+
+// serviceVersions returns the versions of the service sorted by id.
+func (s *Server) serviceVersions(service string) []*appengine.Version {
+	var versions []*appengine.Version
+
+	for name, v := range s.versions {
+		if strings.HasPrefix(name, service+"/versions/") {
+			versions = append(versions, v)
+		}
+	}
+
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Id < versions[j].Id })
+
+	return versions
+}
+
+func serviceName(project, service string) string {
+	return "apps/" + project + "/services/" + service
+}
+
+func versionName(project, service, versionID string) string {
+	return serviceName(project, service) + "/versions/" + versionID
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes an error in the format of the Google APIs.
+func writeError(w http.ResponseWriter, code int, status, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+
+	_ = json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"code":    code,
+			"message": message,
+			"status":  status,
+		},
+	})
+}
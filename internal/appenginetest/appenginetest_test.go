@@ -0,0 +1,73 @@
+package appenginetest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"google.golang.org/api/appengine/v1"
+)
+
+func TestServer_operations(t *testing.T) {
+	ctx := context.Background()
+
+	fake := NewServer()
+	defer fake.Close()
+
+	fake.OperationPolls = 3
+
+	svc, err := appengine.NewService(ctx, fake.ClientOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op, err := svc.Apps.Services.Versions.Create("project", "api", &appengine.Version{Id: "v1", Runtime: "go114"}).Do()
+	if err != nil {
+		t.Fatalf("Versions.Create() error = %v", err)
+	}
+
+	for i := 1; i <= fake.OperationPolls; i++ {
+		if op.Done {
+			t.Fatalf("operation done after %d polls, want %d", i-1, fake.OperationPolls)
+		}
+
+		if fake.Version("project", "api", "v1") != nil {
+			t.Fatalf("version created before the operation is done")
+		}
+
+		op, err = svc.Apps.Operations.Get("project", operationIDOf(op)).Do()
+		if err != nil {
+			t.Fatalf("Operations.Get() error = %v", err)
+		}
+	}
+
+	if !op.Done || op.Error != nil {
+		t.Fatalf("operation = %+v, want done without error", op)
+	}
+
+	v, err := svc.Apps.Services.Versions.Get("project", "api", "v1").View("FULL").Do()
+	if err != nil {
+		t.Fatalf("Versions.Get() error = %v", err)
+	}
+
+	if v.Runtime != "go114" || v.ServingStatus != "SERVING" {
+		t.Errorf("Versions.Get() = %+v", v)
+	}
+
+	aes, err := svc.Apps.Services.Get("project", "api").Do()
+	if err != nil {
+		t.Fatalf("Services.Get() error = %v", err)
+	}
+
+	if aes.Split.Allocations["v1"] != 1 {
+		t.Errorf("Services.Get() split = %v, want all the traffic to the first version", aes.Split.Allocations)
+	}
+
+	if _, err := svc.Apps.Services.Versions.Delete("project", "api", "v1").Do(); err == nil {
+		t.Errorf("Versions.Delete() of a version receiving traffic should fail")
+	}
+}
+
+func operationIDOf(op *appengine.Operation) string {
+	return strings.TrimPrefix(op.Name, "apps/project/operations/")
+}
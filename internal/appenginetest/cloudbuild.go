@@ -0,0 +1,118 @@
+package appenginetest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/cloudbuild/v1"
+	"google.golang.org/api/storage/v1"
+)
+
+// AddBuildLogs sets the logs the next version built in the service writes.
+// A chunk is appended to the logs object of its build on every poll of the
+// create operation, the remaining ones once the build finishes. Chunks do
+// not have to end with a new line.
+func (s *Server) AddBuildLogs(project, service string, chunks ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.buildLogs[serviceName(project, service)] = chunks
+}
+
+// Build returns the Cloud Build build, or nil if it does not exist.
+func (s *Server) Build(project, buildID string) *cloudbuild.Build {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.builds[project+"/"+buildID]
+}
+
+// startBuild records the Cloud Build build of a new version of the service,
+// which writes the logs set for the service to the logs bucket of the
+// project.
+func (s *Server) startBuild(project, service string) *build {
+	b := &build{
+		meta: &cloudbuild.Build{
+			Id:         "build-" + strconv.Itoa(len(s.builds)+1),
+			ProjectId:  project,
+			LogsBucket: "gs://" + project + "_cloudbuild",
+			Status:     "WORKING",
+			CreateTime: time.Now().UTC().Format(time.RFC3339),
+		},
+		chunks: s.buildLogs[serviceName(project, service)],
+	}
+
+	delete(s.buildLogs, serviceName(project, service))
+
+	s.builds[project+"/"+b.meta.Id] = b.meta
+
+	return b
+}
+
+// attachBuild sets the id of the build in the metadata of the version create
+// operation, and writes a chunk of logs on every poll of the operation.
+func (s *Server) attachBuild(op *appengine.Operation, b *build) {
+	var md appengine.OperationMetadataV1
+	_ = json.Unmarshal(op.Metadata, &md)
+	md.CreateVersionMetadata = &appengine.CreateVersionMetadataV1{CloudBuildId: b.meta.Id}
+	op.Metadata, _ = json.Marshal(&md)
+
+	s.operations[op.Name].progress = func() { s.writeBuildLogs(b, 1) }
+}
+
+// build is a Cloud Build build with the logs it has yet to write.
+type build struct {
+	meta   *cloudbuild.Build
+	chunks []string
+}
+
+// finishBuild writes the remaining logs and sets the status of the build.
+func (s *Server) finishBuild(b *build, failed bool) {
+	s.writeBuildLogs(b, len(b.chunks))
+
+	b.meta.Status = "SUCCESS"
+	if failed {
+		b.meta.Status = "FAILURE"
+	}
+}
+
+// writeBuildLogs appends the next n chunks to the logs object of the build.
+func (s *Server) writeBuildLogs(b *build, n int) {
+	if n > len(b.chunks) {
+		n = len(b.chunks)
+	}
+
+	if n == 0 {
+		return
+	}
+
+	bucket := b.meta.LogsBucket[len("gs://"):]
+	name := "log-" + b.meta.Id + ".txt"
+
+	obj, ok := s.objects[bucket+"/"+name]
+	if !ok {
+		obj = &object{meta: &storage.Object{Bucket: bucket, Name: name, Generation: time.Now().UnixNano()}}
+		s.objects[bucket+"/"+name] = obj
+	}
+
+	for _, chunk := range b.chunks[:n] {
+		obj.data = append(obj.data, chunk...)
+	}
+
+	obj.meta.Size = uint64(len(obj.data))
+	b.chunks = b.chunks[n:]
+}
+
+// serveBuild serves a Cloud Build build.
+func (s *Server) serveBuild(w http.ResponseWriter, r *http.Request, project, buildID string) {
+	b, ok := s.builds[project+"/"+buildID]
+	if r.Method != http.MethodGet || !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Build not found: "+buildID)
+		return
+	}
+
+	writeJSON(w, b)
+}
@@ -0,0 +1,243 @@
+package appenginetest
+
+import (
+	"context"
+	"errors"
+
+	"google.golang.org/api/appengine/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+var _ appengineutil.Client = (*MockClient)(nil)
+
+// errNotMocked is returned by the calls with no mock function.
+var errNotMocked = errors.New("appenginetest: call not mocked")
+
+// MockClient is an appengineutil.Client calling the function set for each
+// method. Calls with no function return an error. The names of the methods
+// called are recorded in Calls.
+type MockClient struct {
+	GetApplicationFunc          func(project string) (*appengine.Application, error)
+	PatchApplicationFunc        func(project string, app *appengine.Application, updateMask string) (*appengine.Operation, error)
+	GetServiceFunc              func(project, service string) (*appengine.Service, error)
+	PatchServiceFunc            func(project, service string, aes *appengine.Service, updateMask string) (*appengine.Operation, error)
+	DeleteServiceFunc           func(project, service string) (*appengine.Operation, error)
+	CreateVersionFunc           func(project, service string, aev *appengine.Version) (*appengine.Operation, error)
+	GetVersionFunc              func(project, service, versionID, view string) (*appengine.Version, error)
+	ListVersionsFunc            func(project, service, view string) ([]*appengine.Version, error)
+	PatchVersionFunc            func(project, service, versionID string, aev *appengine.Version, updateMask string) (*appengine.Operation, error)
+	DeleteVersionFunc           func(project, service, versionID string) (*appengine.Operation, error)
+	ListInstancesFunc           func(project, service, versionID string) ([]*appengine.Instance, error)
+	GetOperationFunc            func(project, operationID string) (*appengine.Operation, error)
+	GetDomainMappingFunc        func(project, domain string) (*appengine.DomainMapping, error)
+	CreateDomainMappingFunc     func(project string, m *appengine.DomainMapping) (*appengine.Operation, error)
+	PatchDomainMappingFunc      func(project, domain string, m *appengine.DomainMapping, updateMask string) (*appengine.Operation, error)
+	ListIngressRulesFunc        func(project string) ([]*appengine.FirewallRule, error)
+	BatchUpdateIngressRulesFunc func(project string, rules []*appengine.FirewallRule) error
+
+	// Calls are the names of the methods called, in order.
+	Calls []string
+}
+
+// DoneOperation returns an operation which is already done.
+func DoneOperation(project string) *appengine.Operation {
+	return &appengine.Operation{Name: "apps/" + project + "/operations/done", Done: true}
+}
+
+func (m *MockClient) GetApplication(_ context.Context, project string) (*appengine.Application, error) {
+	m.Calls = append(m.Calls, "GetApplication")
+	if m.GetApplicationFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.GetApplicationFunc(project)
+}
+
+func (m *MockClient) PatchApplication(
+	_ context.Context,
+	project string,
+	app *appengine.Application,
+	updateMask string,
+) (*appengine.Operation, error) {
+	m.Calls = append(m.Calls, "PatchApplication")
+	if m.PatchApplicationFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.PatchApplicationFunc(project, app, updateMask)
+}
+
+func (m *MockClient) GetService(_ context.Context, project, service string) (*appengine.Service, error) {
+	m.Calls = append(m.Calls, "GetService")
+	if m.GetServiceFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.GetServiceFunc(project, service)
+}
+
+func (m *MockClient) PatchService(
+	_ context.Context,
+	project string,
+	service string,
+	aes *appengine.Service,
+	updateMask string,
+) (*appengine.Operation, error) {
+	m.Calls = append(m.Calls, "PatchService")
+	if m.PatchServiceFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.PatchServiceFunc(project, service, aes, updateMask)
+}
+
+func (m *MockClient) DeleteService(_ context.Context, project, service string) (*appengine.Operation, error) {
+	m.Calls = append(m.Calls, "DeleteService")
+	if m.DeleteServiceFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.DeleteServiceFunc(project, service)
+}
+
+func (m *MockClient) CreateVersion(
+	_ context.Context,
+	project string,
+	service string,
+	aev *appengine.Version,
+) (*appengine.Operation, error) {
+	m.Calls = append(m.Calls, "CreateVersion")
+	if m.CreateVersionFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.CreateVersionFunc(project, service, aev)
+}
+
+func (m *MockClient) GetVersion(
+	_ context.Context,
+	project string,
+	service string,
+	versionID string,
+	view string,
+) (*appengine.Version, error) {
+	m.Calls = append(m.Calls, "GetVersion")
+	if m.GetVersionFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.GetVersionFunc(project, service, versionID, view)
+}
+
+func (m *MockClient) ListVersions(_ context.Context, project, service, view string) ([]*appengine.Version, error) {
+	m.Calls = append(m.Calls, "ListVersions")
+	if m.ListVersionsFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.ListVersionsFunc(project, service, view)
+}
+
+func (m *MockClient) PatchVersion(
+	_ context.Context,
+	project string,
+	service string,
+	versionID string,
+	aev *appengine.Version,
+	updateMask string,
+) (*appengine.Operation, error) {
+	m.Calls = append(m.Calls, "PatchVersion")
+	if m.PatchVersionFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.PatchVersionFunc(project, service, versionID, aev, updateMask)
+}
+
+func (m *MockClient) DeleteVersion(_ context.Context, project, service, versionID string) (*appengine.Operation, error) {
+	m.Calls = append(m.Calls, "DeleteVersion")
+	if m.DeleteVersionFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.DeleteVersionFunc(project, service, versionID)
+}
+
+func (m *MockClient) ListInstances(
+	_ context.Context,
+	project string,
+	service string,
+	versionID string,
+) ([]*appengine.Instance, error) {
+	m.Calls = append(m.Calls, "ListInstances")
+	if m.ListInstancesFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.ListInstancesFunc(project, service, versionID)
+}
+
+func (m *MockClient) GetOperation(_ context.Context, project, operationID string) (*appengine.Operation, error) {
+	m.Calls = append(m.Calls, "GetOperation")
+	if m.GetOperationFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.GetOperationFunc(project, operationID)
+}
+
+func (m *MockClient) GetDomainMapping(_ context.Context, project, domain string) (*appengine.DomainMapping, error) {
+	m.Calls = append(m.Calls, "GetDomainMapping")
+	if m.GetDomainMappingFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.GetDomainMappingFunc(project, domain)
+}
+
+func (m *MockClient) CreateDomainMapping(
+	_ context.Context,
+	project string,
+	dm *appengine.DomainMapping,
+) (*appengine.Operation, error) {
+	m.Calls = append(m.Calls, "CreateDomainMapping")
+	if m.CreateDomainMappingFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.CreateDomainMappingFunc(project, dm)
+}
+
+func (m *MockClient) PatchDomainMapping(
+	_ context.Context,
+	project string,
+	domain string,
+	dm *appengine.DomainMapping,
+	updateMask string,
+) (*appengine.Operation, error) {
+	m.Calls = append(m.Calls, "PatchDomainMapping")
+	if m.PatchDomainMappingFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.PatchDomainMappingFunc(project, domain, dm, updateMask)
+}
+
+func (m *MockClient) ListIngressRules(_ context.Context, project string) ([]*appengine.FirewallRule, error) {
+	m.Calls = append(m.Calls, "ListIngressRules")
+	if m.ListIngressRulesFunc == nil {
+		return nil, errNotMocked
+	}
+
+	return m.ListIngressRulesFunc(project)
+}
+
+func (m *MockClient) BatchUpdateIngressRules(_ context.Context, project string, rules []*appengine.FirewallRule) error {
+	m.Calls = append(m.Calls, "BatchUpdateIngressRules")
+	if m.BatchUpdateIngressRulesFunc == nil {
+		return errNotMocked
+	}
+
+	return m.BatchUpdateIngressRulesFunc(project, rules)
+}
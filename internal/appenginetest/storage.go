@@ -0,0 +1,187 @@
+package appenginetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/api/storage/v1"
+)
+
+// object is a Cloud Storage object.
+type object struct {
+	meta *storage.Object
+	data []byte
+}
+
+// AddObject adds an object to a Cloud Storage bucket, for example the
+// artifact to deploy.
+func (s *Server) AddObject(bucket, name string, data []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.objects[bucket+"/"+name] = &object{
+		meta: &storage.Object{
+			Bucket:     bucket,
+			Name:       name,
+			Size:       uint64(len(data)),
+			Generation: time.Now().UnixNano(),
+		},
+		data: data,
+	}
+}
+
+// Object returns the content of an object, or false if it does not exist.
+func (s *Server) Object(bucket, name string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	obj, ok := s.objects[bucket+"/"+name]
+	if !ok {
+		return nil, false
+	}
+
+	return obj.data, true
+}
+
+// Objects returns the names of the objects of a bucket starting with
+// prefix, sorted.
+func (s *Server) Objects(bucket, prefix string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var names []string
+
+	for _, obj := range s.objects {
+		if obj.meta.Bucket == bucket && strings.HasPrefix(obj.meta.Name, prefix) {
+			names = append(names, obj.meta.Name)
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// listObjects serves the objects of the bucket starting with the prefix
+// query parameter, in a single page.
+func (s *Server) listObjects(w http.ResponseWriter, r *http.Request, bucket string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Unknown path "+r.URL.Path)
+		return
+	}
+
+	prefix := r.URL.Query().Get("prefix")
+	list := &storage.Objects{Kind: "storage#objects"}
+
+	for _, obj := range s.objects {
+		if obj.meta.Bucket == bucket && strings.HasPrefix(obj.meta.Name, prefix) {
+			list.Items = append(list.Items, obj.meta)
+		}
+	}
+
+	sort.Slice(list.Items, func(i, j int) bool { return list.Items[i].Name < list.Items[j].Name })
+
+	writeJSON(w, list)
+}
+
+// serveObject serves the object metadata, or its content with alt=media.
+// Ranged reads are supported. Objects can be deleted.
+func (s *Server) serveObject(w http.ResponseWriter, r *http.Request, bucket, name string) {
+	obj, ok := s.objects[bucket+"/"+name]
+	if (r.Method != http.MethodGet && r.Method != http.MethodDelete) || !ok {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "No such object: "+bucket+"/"+name)
+		return
+	}
+
+	if r.Method == http.MethodDelete {
+		delete(s.objects, bucket+"/"+name)
+		w.WriteHeader(http.StatusNoContent)
+
+		return
+	}
+
+	if r.URL.Query().Get("alt") != "media" {
+		writeJSON(w, obj.meta)
+		return
+	}
+
+	w.Header().Set("X-Goog-Generation", strconv.FormatInt(obj.meta.Generation, 10))
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(obj.data))
+}
+
+// serveUpload stores an object sent as a multipart upload, its metadata
+// followed by its content.
+func (s *Server) serveUpload(w http.ResponseWriter, r *http.Request, bucket string) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.Method != http.MethodPost || err != nil || mediaType != "multipart/related" {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", "Only multipart uploads are supported")
+		return
+	}
+
+	mr := multipart.NewReader(r.Body, params["boundary"])
+
+	var meta storage.Object
+
+	part, err := mr.NextPart()
+	if err == nil {
+		err = json.NewDecoder(part).Decode(&meta)
+	}
+
+	var data []byte
+
+	if err == nil {
+		part, err = mr.NextPart()
+	}
+
+	if err == nil {
+		data, err = ioutil.ReadAll(part)
+	}
+
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "INVALID_ARGUMENT", err.Error())
+		return
+	}
+
+	meta.Bucket = bucket
+	meta.Size = uint64(len(data))
+	meta.Generation = time.Now().UnixNano()
+
+	s.objects[bucket+"/"+meta.Name] = &object{meta: &meta, data: data}
+
+	writeJSON(w, &meta)
+}
+
+// SetBucketPolicy sets the IAM policy of a bucket. Buckets have an empty
+// policy by default.
+func (s *Server) SetBucketPolicy(bucket string, policy *storage.Policy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policies[bucket] = policy
+}
+
+// serveBucketIAM serves the policy of the bucket.
+func (s *Server) serveBucketIAM(w http.ResponseWriter, r *http.Request, bucket string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusNotFound, "NOT_FOUND", "Unknown path "+r.URL.Path)
+		return
+	}
+
+	policy, ok := s.policies[bucket]
+	if !ok {
+		policy = &storage.Policy{}
+	}
+
+	c := *policy
+	c.Kind = "storage#policy"
+
+	writeJSON(w, &c)
+}
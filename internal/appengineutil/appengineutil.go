@@ -2,12 +2,17 @@ package appengineutil
 
 import (
 	"context"
+	"encoding/json"
 	"strings"
 	"time"
 
 	"google.golang.org/api/appengine/v1"
 )
 
+// PollInterval is the delay between two polls of an operation. It is a
+// variable so tests can shorten it.
+var PollInterval = 1 * time.Second
+
 // operationID parses the operation id out of an operation name.
 func operationID(opName string) string {
 	// The operation opName has the format: apps/project-id/operations/op-id
@@ -22,12 +27,43 @@ func projectID(opName string) string {
 	return split[1]
 }
 
+// CloudBuildID parses the id of the Cloud Build build created by a version
+// create operation out of the operation metadata. It returns an empty string
+// when the build has not been created yet.
+func CloudBuildID(op *appengine.Operation) (string, error) {
+	if len(op.Metadata) == 0 {
+		return "", nil
+	}
+
+	var md appengine.OperationMetadataV1
+	if err := json.Unmarshal(op.Metadata, &md); err != nil {
+		return "", err
+	}
+
+	if md.CreateVersionMetadata == nil {
+		return "", nil
+	}
+
+	return md.CreateVersionMetadata.CloudBuildId, nil
+}
+
 // WaitForOperation keeps polling long the operation until it finishes either
 // successfully or with an error.
 func WaitForOperation(
 	ctx context.Context,
-	service *appengine.APIService,
+	client Client,
+	op *appengine.Operation,
+) (*appengine.Operation, error) {
+	return WaitForOperationWithProgress(ctx, client, op, nil)
+}
+
+// WaitForOperationWithProgress is like WaitForOperation but calls progress
+// with the latest state of the operation after every poll.
+func WaitForOperationWithProgress(
+	ctx context.Context,
+	client Client,
 	op *appengine.Operation,
+	progress func(op *appengine.Operation),
 ) (*appengine.Operation, error) {
 	opID := operationID(op.Name)
 	app := projectID(op.Name)
@@ -35,15 +71,33 @@ func WaitForOperation(
 	var err error
 
 	for !op.Done {
-		opCall := service.Apps.Operations.Get(app, opID)
-		opCall = opCall.Context(ctx)
-		op, err = opCall.Do()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(PollInterval):
+		}
+
+		op, err = client.GetOperation(ctx, app, opID)
 		if err != nil {
 			return nil, err
 		}
 
-		time.Sleep(1 * time.Second)
+		if progress != nil {
+			progress(op)
+		}
 	}
 
 	return op, nil
 }
+
+// LocationRegion returns the Cloud region of an App Engine location. Two App
+// Engine locations, us-central and europe-west, are named after their region
+// without its trailing number.
+func LocationRegion(locationID string) string {
+	switch locationID {
+	case "us-central", "europe-west":
+		return locationID + "1"
+	default:
+		return locationID
+	}
+}
@@ -1,7 +1,12 @@
 package appengineutil
 
 import (
+	"context"
 	"testing"
+	"time"
+
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/googleapi"
 )
 
 func Test_operationID(t *testing.T) {
@@ -51,3 +56,128 @@ func Test_projectID(t *testing.T) {
 		})
 	}
 }
+
+func TestCloudBuildID(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata string
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "create version",
+			metadata: `{"@type":"type.googleapis.com/google.appengine.v1.OperationMetadataV1","createVersionMetadata":{"cloudBuildId":"build-id"}}`,
+			want:     "build-id",
+		},
+		{
+			name:     "other operation",
+			metadata: `{"@type":"type.googleapis.com/google.appengine.v1.OperationMetadataV1","method":"google.appengine.v1.Services.UpdateService"}`,
+			want:     "",
+		},
+		{
+			name:     "no metadata",
+			metadata: "",
+			want:     "",
+		},
+		{
+			name:     "invalid metadata",
+			metadata: "{",
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			op := &appengine.Operation{Metadata: googleapi.RawMessage(tt.metadata)}
+
+			got, err := CloudBuildID(op)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CloudBuildID() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("CloudBuildID() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// operationClient is a Client returning the operations in turn.
+type operationClient struct {
+	Client
+	ops   []*appengine.Operation
+	calls int
+}
+
+func (c *operationClient) GetOperation(context.Context, string, string) (*appengine.Operation, error) {
+	op := c.ops[c.calls]
+	c.calls++
+
+	return op, nil
+}
+
+func TestWaitForOperationWithProgress(t *testing.T) {
+	defer func(interval time.Duration) { PollInterval = interval }(PollInterval)
+
+	PollInterval = time.Millisecond
+
+	op := &appengine.Operation{Name: "apps/project/operations/op"}
+
+	t.Run("done", func(t *testing.T) {
+		client := &operationClient{ops: []*appengine.Operation{
+			{Name: op.Name},
+			{Name: op.Name, Done: true},
+		}}
+
+		var progress int
+
+		got, err := WaitForOperationWithProgress(context.Background(), client, op, func(*appengine.Operation) {
+			progress++
+		})
+		if err != nil {
+			t.Fatalf("WaitForOperationWithProgress() error = %v", err)
+		}
+
+		if !got.Done || client.calls != 2 || progress != 2 {
+			t.Errorf("WaitForOperationWithProgress() done = %v, polls = %d, progress = %d, want true, 2, 2",
+				got.Done, client.calls, progress)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		PollInterval = time.Hour
+
+		client := &operationClient{}
+
+		if _, err := WaitForOperationWithProgress(ctx, client, op, nil); err != context.Canceled {
+			t.Errorf("WaitForOperationWithProgress() error = %v, want %v", err, context.Canceled)
+		}
+
+		if client.calls != 0 {
+			t.Errorf("WaitForOperationWithProgress() polls = %d, want 0", client.calls)
+		}
+	})
+}
+
+func TestLocationRegion(t *testing.T) {
+	tests := []struct {
+		locationID string
+		want       string
+	}{
+		{locationID: "us-central", want: "us-central1"},
+		{locationID: "europe-west", want: "europe-west1"},
+		{locationID: "europe-west3", want: "europe-west3"},
+		{locationID: "asia-northeast1", want: "asia-northeast1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.locationID, func(t *testing.T) {
+			if got := LocationRegion(tt.locationID); got != tt.want {
+				t.Errorf("LocationRegion() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
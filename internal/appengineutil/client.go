@@ -0,0 +1,246 @@
+package appengineutil
+
+import (
+	"context"
+
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/option"
+)
+
+// Client is the subset of the App Engine Admin API the plugin uses. The
+// errors returned by the API are converted with APIError.
+type Client interface {
+	// GetApplication returns the application of the project.
+	GetApplication(ctx context.Context, project string) (*appengine.Application, error)
+	// PatchApplication updates the fields of the application listed in
+	// updateMask.
+	PatchApplication(
+		ctx context.Context, project string, app *appengine.Application, updateMask string,
+	) (*appengine.Operation, error)
+
+	// GetService returns the service.
+	GetService(ctx context.Context, project, service string) (*appengine.Service, error)
+	// PatchService updates the fields of the service listed in updateMask.
+	PatchService(
+		ctx context.Context, project, service string, aes *appengine.Service, updateMask string,
+	) (*appengine.Operation, error)
+	// DeleteService deletes the service with all its versions.
+	DeleteService(ctx context.Context, project, service string) (*appengine.Operation, error)
+
+	// CreateVersion creates a version of the service.
+	CreateVersion(ctx context.Context, project, service string, aev *appengine.Version) (*appengine.Operation, error)
+	// GetVersion returns the version, view is either "BASIC" or "FULL".
+	GetVersion(ctx context.Context, project, service, versionID, view string) (*appengine.Version, error)
+	// ListVersions returns all the versions of the service, view is either
+	// "BASIC" or "FULL".
+	ListVersions(ctx context.Context, project, service, view string) ([]*appengine.Version, error)
+	// PatchVersion updates the fields of the version listed in updateMask.
+	PatchVersion(
+		ctx context.Context, project, service, versionID string, aev *appengine.Version, updateMask string,
+	) (*appengine.Operation, error)
+	// DeleteVersion deletes the version.
+	DeleteVersion(ctx context.Context, project, service, versionID string) (*appengine.Operation, error)
+	// ListInstances returns the running instances of the version.
+	ListInstances(ctx context.Context, project, service, versionID string) ([]*appengine.Instance, error)
+
+	// GetOperation returns the latest state of the operation.
+	GetOperation(ctx context.Context, project, operationID string) (*appengine.Operation, error)
+
+	// GetDomainMapping returns the mapping of the domain.
+	GetDomainMapping(ctx context.Context, project, domain string) (*appengine.DomainMapping, error)
+	// CreateDomainMapping maps a domain to the application.
+	CreateDomainMapping(ctx context.Context, project string, m *appengine.DomainMapping) (*appengine.Operation, error)
+	// PatchDomainMapping updates the fields of the mapping listed in
+	// updateMask.
+	PatchDomainMapping(
+		ctx context.Context, project, domain string, m *appengine.DomainMapping, updateMask string,
+	) (*appengine.Operation, error)
+
+	// ListIngressRules returns all the firewall ingress rules.
+	ListIngressRules(ctx context.Context, project string) ([]*appengine.FirewallRule, error)
+	// BatchUpdateIngressRules replaces the firewall ingress rules.
+	BatchUpdateIngressRules(ctx context.Context, project string, rules []*appengine.FirewallRule) error
+}
+
+// apiClient implements Client with the generated App Engine Admin API
+// client.
+type apiClient struct {
+	service *appengine.APIService
+}
+
+// NewClient returns a Client calling the App Engine Admin API.
+func NewClient(ctx context.Context, opts ...option.ClientOption) (Client, error) {
+	service, err := appengine.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &apiClient{service: service}, nil
+}
+
+func (c *apiClient) GetApplication(ctx context.Context, project string) (*appengine.Application, error) {
+	app, err := c.service.Apps.Get(project).Context(ctx).Do()
+	return app, APIError(err)
+}
+
+func (c *apiClient) PatchApplication(
+	ctx context.Context,
+	project string,
+	app *appengine.Application,
+	updateMask string,
+) (*appengine.Operation, error) {
+	op, err := c.service.Apps.Patch(project, app).UpdateMask(updateMask).Context(ctx).Do()
+	return op, APIError(err)
+}
+
+func (c *apiClient) GetService(ctx context.Context, project, service string) (*appengine.Service, error) {
+	aes, err := c.service.Apps.Services.Get(project, service).Context(ctx).Do()
+	return aes, APIError(err)
+}
+
+func (c *apiClient) PatchService(
+	ctx context.Context,
+	project string,
+	service string,
+	aes *appengine.Service,
+	updateMask string,
+) (*appengine.Operation, error) {
+	op, err := c.service.Apps.Services.Patch(project, service, aes).UpdateMask(updateMask).Context(ctx).Do()
+	return op, APIError(err)
+}
+
+func (c *apiClient) DeleteService(ctx context.Context, project, service string) (*appengine.Operation, error) {
+	op, err := c.service.Apps.Services.Delete(project, service).Context(ctx).Do()
+	return op, APIError(err)
+}
+
+func (c *apiClient) CreateVersion(
+	ctx context.Context,
+	project string,
+	service string,
+	aev *appengine.Version,
+) (*appengine.Operation, error) {
+	op, err := c.service.Apps.Services.Versions.Create(project, service, aev).Context(ctx).Do()
+	return op, APIError(err)
+}
+
+func (c *apiClient) GetVersion(
+	ctx context.Context,
+	project string,
+	service string,
+	versionID string,
+	view string,
+) (*appengine.Version, error) {
+	aev, err := c.service.Apps.Services.Versions.Get(project, service, versionID).View(view).Context(ctx).Do()
+	return aev, APIError(err)
+}
+
+func (c *apiClient) ListVersions(ctx context.Context, project, service, view string) ([]*appengine.Version, error) {
+	var versions []*appengine.Version
+
+	listCall := c.service.Apps.Services.Versions.List(project, service).View(view)
+	err := listCall.Pages(ctx, func(resp *appengine.ListVersionsResponse) error {
+		versions = append(versions, resp.Versions...)
+		return nil
+	})
+	if err != nil {
+		return nil, APIError(err)
+	}
+
+	return versions, nil
+}
+
+func (c *apiClient) PatchVersion(
+	ctx context.Context,
+	project string,
+	service string,
+	versionID string,
+	aev *appengine.Version,
+	updateMask string,
+) (*appengine.Operation, error) {
+	patchCall := c.service.Apps.Services.Versions.Patch(project, service, versionID, aev)
+	op, err := patchCall.UpdateMask(updateMask).Context(ctx).Do()
+
+	return op, APIError(err)
+}
+
+func (c *apiClient) DeleteVersion(ctx context.Context, project, service, versionID string) (*appengine.Operation, error) {
+	op, err := c.service.Apps.Services.Versions.Delete(project, service, versionID).Context(ctx).Do()
+	return op, APIError(err)
+}
+
+func (c *apiClient) ListInstances(
+	ctx context.Context,
+	project string,
+	service string,
+	versionID string,
+) ([]*appengine.Instance, error) {
+	var instances []*appengine.Instance
+
+	listCall := c.service.Apps.Services.Versions.Instances.List(project, service, versionID)
+	err := listCall.Pages(ctx, func(resp *appengine.ListInstancesResponse) error {
+		instances = append(instances, resp.Instances...)
+		return nil
+	})
+	if err != nil {
+		return nil, APIError(err)
+	}
+
+	return instances, nil
+}
+
+func (c *apiClient) GetOperation(ctx context.Context, project, operationID string) (*appengine.Operation, error) {
+	op, err := c.service.Apps.Operations.Get(project, operationID).Context(ctx).Do()
+	return op, APIError(err)
+}
+
+func (c *apiClient) GetDomainMapping(ctx context.Context, project, domain string) (*appengine.DomainMapping, error) {
+	m, err := c.service.Apps.DomainMappings.Get(project, domain).Context(ctx).Do()
+	return m, APIError(err)
+}
+
+func (c *apiClient) CreateDomainMapping(
+	ctx context.Context,
+	project string,
+	m *appengine.DomainMapping,
+) (*appengine.Operation, error) {
+	op, err := c.service.Apps.DomainMappings.Create(project, m).Context(ctx).Do()
+	return op, APIError(err)
+}
+
+func (c *apiClient) PatchDomainMapping(
+	ctx context.Context,
+	project string,
+	domain string,
+	m *appengine.DomainMapping,
+	updateMask string,
+) (*appengine.Operation, error) {
+	op, err := c.service.Apps.DomainMappings.Patch(project, domain, m).UpdateMask(updateMask).Context(ctx).Do()
+	return op, APIError(err)
+}
+
+func (c *apiClient) ListIngressRules(ctx context.Context, project string) ([]*appengine.FirewallRule, error) {
+	var rules []*appengine.FirewallRule
+
+	listCall := c.service.Apps.Firewall.IngressRules.List(project)
+	err := listCall.Pages(ctx, func(resp *appengine.ListIngressRulesResponse) error {
+		rules = append(rules, resp.IngressRules...)
+		return nil
+	})
+	if err != nil {
+		return nil, APIError(err)
+	}
+
+	return rules, nil
+}
+
+func (c *apiClient) BatchUpdateIngressRules(ctx context.Context, project string, rules []*appengine.FirewallRule) error {
+	batchUpdateCall := c.service.Apps.Firewall.IngressRules.BatchUpdate(
+		project,
+		&appengine.BatchUpdateIngressRulesRequest{IngressRules: rules},
+	)
+
+	_, err := batchUpdateCall.Context(ctx).Do()
+
+	return APIError(err)
+}
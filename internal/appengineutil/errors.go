@@ -0,0 +1,221 @@
+package appengineutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Kind classifies App Engine API failures.
+type Kind int
+
+const (
+	// Unknown is a failure that does not fit any other kind.
+	Unknown Kind = iota
+	// NotFound means the requested App Engine resource does not exist.
+	NotFound
+	// PermissionDenied means the caller is not allowed to perform the request.
+	PermissionDenied
+	// QuotaExceeded means a quota or rate limit was exhausted.
+	QuotaExceeded
+	// InvalidArgument means the request, usually the version config, is invalid.
+	InvalidArgument
+	// BuildFailed means the version could not be built on Cloud Build.
+	BuildFailed
+)
+
+func (k Kind) String() string {
+	switch k {
+	case NotFound:
+		return "not found"
+	case PermissionDenied:
+		return "permission denied"
+	case QuotaExceeded:
+		return "quota exceeded"
+	case InvalidArgument:
+		return "invalid argument"
+	case BuildFailed:
+		return "build failed"
+	default:
+		return "unknown"
+	}
+}
+
+// Sentinel errors to compare failures with errors.Is.
+var (
+	ErrNotFound         = &Error{Kind: NotFound}
+	ErrPermissionDenied = &Error{Kind: PermissionDenied}
+	ErrQuotaExceeded    = &Error{Kind: QuotaExceeded}
+	ErrInvalidArgument  = &Error{Kind: InvalidArgument}
+	ErrBuildFailed      = &Error{Kind: BuildFailed}
+)
+
+// Error is a typed App Engine API failure. It keeps the status code and the
+// details returned by the API.
+type Error struct {
+	Kind Kind
+	// Code is the gRPC code of the failure.
+	Code    codes.Code
+	Message string
+	// Details are the JSON encoded error details returned by the API.
+	Details []string
+}
+
+func (e *Error) Error() string {
+	return e.Kind.String() + ": " + e.Message
+}
+
+// Is reports whether target is an *Error of the same kind, which allows
+// matching the sentinel errors with errors.Is.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Kind == e.Kind
+}
+
+// GRPCStatus converts the error to a gRPC status Waypoint can render.
+func (e *Error) GRPCStatus() *status.Status {
+	return status.New(e.Code, e.Error())
+}
+
+// Annotate appends the note to the message of the *Error in err. The *Error
+// is returned instead of a wrapping error, status.FromError does not unwrap
+// errors and Waypoint would lose the status code. Other errors are wrapped.
+func Annotate(err error, note string) error {
+	var e *Error
+	if !errors.As(err, &e) {
+		return fmt.Errorf("%w (%s)", err, note)
+	}
+
+	c := *e
+	c.Message += " (" + note + ")"
+
+	return &c
+}
+
+// OperationError converts the error of a finished operation to an *Error.
+// It returns nil if the operation succeeded.
+func OperationError(op *appengine.Operation) error {
+	if op.Error == nil {
+		return nil
+	}
+
+	code := codes.Code(op.Error.Code)
+
+	details := make([]string, len(op.Error.Details))
+	for i, d := range op.Error.Details {
+		details[i] = string(d)
+	}
+
+	return &Error{
+		Kind:    kindFromCode(code),
+		Code:    code,
+		Message: op.Error.Message,
+		Details: details,
+	}
+}
+
+// BuildError converts the error of a failed version create operation to an
+// *Error of kind BuildFailed. It returns nil if the operation succeeded.
+func BuildError(op *appengine.Operation) error {
+	err := OperationError(op)
+	if err == nil {
+		return nil
+	}
+
+	e := err.(*Error)
+	e.Kind = BuildFailed
+
+	return e
+}
+
+// APIError converts a *googleapi.Error to an *Error. Any other error is
+// returned unchanged.
+func APIError(err error) error {
+	gerr, ok := err.(*googleapi.Error)
+	if !ok {
+		return err
+	}
+
+	code := codeFromHTTP(gerr)
+
+	var details []string
+
+	for _, d := range gerr.Details {
+		if b, err := json.Marshal(d); err == nil {
+			details = append(details, string(b))
+		}
+	}
+
+	for _, item := range gerr.Errors {
+		details = append(details, fmt.Sprintf(`{"reason":%q,"message":%q}`, item.Reason, item.Message))
+	}
+
+	message := gerr.Message
+	if message == "" {
+		message = http.StatusText(gerr.Code)
+	}
+
+	return &Error{
+		Kind:    kindFromCode(code),
+		Code:    code,
+		Message: message,
+		Details: details,
+	}
+}
+
+// codeFromHTTP maps the HTTP status of an API error to a gRPC code.
+func codeFromHTTP(gerr *googleapi.Error) codes.Code {
+	for _, item := range gerr.Errors {
+		switch item.Reason {
+		case "rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded":
+			return codes.ResourceExhausted
+		}
+	}
+
+	switch gerr.Code {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusConflict:
+		return codes.AlreadyExists
+	case http.StatusRequestedRangeNotSatisfiable:
+		return codes.OutOfRange
+	case http.StatusTooManyRequests:
+		return codes.ResourceExhausted
+	case http.StatusNotImplemented:
+		return codes.Unimplemented
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	default:
+		return codes.Unknown
+	}
+}
+
+// kindFromCode classifies a gRPC code.
+func kindFromCode(code codes.Code) Kind {
+	switch code {
+	case codes.NotFound:
+		return NotFound
+	case codes.PermissionDenied, codes.Unauthenticated:
+		return PermissionDenied
+	case codes.ResourceExhausted:
+		return QuotaExceeded
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		return InvalidArgument
+	default:
+		return Unknown
+	}
+}
@@ -0,0 +1,127 @@
+package appengineutil
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAPIError(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		want     error
+		wantCode codes.Code
+	}{
+		{
+			name:     "not found",
+			err:      &googleapi.Error{Code: 404, Message: "Version not found"},
+			want:     ErrNotFound,
+			wantCode: codes.NotFound,
+		},
+		{
+			name:     "permission denied",
+			err:      &googleapi.Error{Code: 403, Message: "Forbidden"},
+			want:     ErrPermissionDenied,
+			wantCode: codes.PermissionDenied,
+		},
+		{
+			name: "quota exceeded",
+			err: &googleapi.Error{
+				Code:    403,
+				Message: "Quota exceeded",
+				Errors:  []googleapi.ErrorItem{{Reason: "quotaExceeded"}},
+			},
+			want:     ErrQuotaExceeded,
+			wantCode: codes.ResourceExhausted,
+		},
+		{
+			name:     "invalid argument",
+			err:      &googleapi.Error{Code: 400, Message: "Invalid runtime"},
+			want:     ErrInvalidArgument,
+			wantCode: codes.InvalidArgument,
+		},
+		{
+			name:     "range not satisfiable",
+			err:      &googleapi.Error{Code: 416, Message: "Requested range not satisfiable"},
+			want:     ErrInvalidArgument,
+			wantCode: codes.OutOfRange,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := APIError(tt.err)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("APIError() = %v, want %v", err, tt.want)
+			}
+
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("status.Code() = %v, want %v", got, tt.wantCode)
+			}
+		})
+	}
+
+	other := errors.New("other")
+	if err := APIError(other); err != other {
+		t.Errorf("APIError() = %v, want %v", err, other)
+	}
+}
+
+func TestOperationError(t *testing.T) {
+	if err := OperationError(&appengine.Operation{Done: true}); err != nil {
+		t.Fatalf("OperationError() = %v, want nil", err)
+	}
+
+	op := &appengine.Operation{
+		Done: true,
+		Error: &appengine.Status{
+			Code:    8,
+			Message: "Version limit reached",
+			Details: []googleapi.RawMessage{googleapi.RawMessage(`{"reason":"limit"}`)},
+		},
+	}
+
+	err := OperationError(op)
+	if !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("OperationError() = %v, want %v", err, ErrQuotaExceeded)
+	}
+
+	var e *Error
+	if !errors.As(err, &e) || len(e.Details) != 1 || e.Details[0] != `{"reason":"limit"}` {
+		t.Errorf("OperationError() details = %v", e)
+	}
+
+	if err := BuildError(op); !errors.Is(err, ErrBuildFailed) || status.Code(err) != codes.ResourceExhausted {
+		t.Errorf("BuildError() = %v, want %v", err, ErrBuildFailed)
+	}
+}
+
+func TestAnnotate(t *testing.T) {
+	build := &Error{Kind: BuildFailed, Code: codes.FailedPrecondition, Message: "Build failed"}
+
+	err := Annotate(fmt.Errorf("wrapped: %w", build), "the failed version 'v2' was deleted")
+
+	s, ok := status.FromError(err)
+	if !ok || s.Code() != codes.FailedPrecondition {
+		t.Errorf("status.FromError() = %v, %v, want %v", s, ok, codes.FailedPrecondition)
+	}
+
+	if want := "build failed: Build failed (the failed version 'v2' was deleted)"; err.Error() != want {
+		t.Errorf("Annotate() = %q, want %q", err.Error(), want)
+	}
+
+	if !errors.Is(err, ErrBuildFailed) || build.Message != "Build failed" {
+		t.Errorf("Annotate() = %v, want a copy of %v", err, build)
+	}
+
+	other := errors.New("other")
+	if err := Annotate(other, "note"); !errors.Is(err, other) || err.Error() != "other (note)" {
+		t.Errorf("Annotate() = %v, want %v wrapped", err, other)
+	}
+}
@@ -0,0 +1,59 @@
+package appengineutil
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+)
+
+// Field is a leaf value of a flattened JSON document.
+type Field struct {
+	// Path is the path of the value, for example handlers[0].urlRegex.
+	Path  string
+	Value string
+}
+
+// Flatten encodes v to JSON and returns its leaf values sorted by path. It
+// is used to render and compare App Engine resources field by field.
+func Flatten(v interface{}) ([]Field, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+
+	var fields []Field
+
+	flatten("", doc, &fields)
+
+	sort.Slice(fields, func(i, j int) bool { return fields[i].Path < fields[j].Path })
+
+	return fields, nil
+}
+
+func flatten(path string, v interface{}, fields *[]Field) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		for k, c := range t {
+			p := k
+			if path != "" {
+				p = path + "." + k
+			}
+
+			flatten(p, c, fields)
+		}
+	case []interface{}:
+		for i, c := range t {
+			flatten(path+"["+strconv.Itoa(i)+"]", c, fields)
+		}
+	case string:
+		*fields = append(*fields, Field{Path: path, Value: t})
+	default:
+		b, _ := json.Marshal(t)
+		*fields = append(*fields, Field{Path: path, Value: string(b)})
+	}
+}
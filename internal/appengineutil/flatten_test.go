@@ -0,0 +1,40 @@
+package appengineutil
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/appengine/v1"
+)
+
+func TestFlatten(t *testing.T) {
+	v := &appengine.Version{
+		Id:           "v1",
+		EnvVariables: map[string]string{"PORT": "8080"},
+		Handlers: []*appengine.UrlMap{
+			{UrlRegex: "/.*", Script: &appengine.ScriptHandler{ScriptPath: "auto"}},
+		},
+		AutomaticScaling: &appengine.AutomaticScaling{
+			StandardSchedulerSettings: &appengine.StandardSchedulerSettings{MaxInstances: 2},
+		},
+		Threadsafe: true,
+	}
+
+	got, err := Flatten(v)
+	if err != nil {
+		t.Fatalf("Flatten() error = %v", err)
+	}
+
+	want := []Field{
+		{Path: "automaticScaling.standardSchedulerSettings.maxInstances", Value: "2"},
+		{Path: "envVariables.PORT", Value: "8080"},
+		{Path: "handlers[0].script.scriptPath", Value: "auto"},
+		{Path: "handlers[0].urlRegex", Value: "/.*"},
+		{Path: "id", Value: "v1"},
+		{Path: "threadsafe", Value: "true"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Flatten() = %v, want %v", got, want)
+	}
+}
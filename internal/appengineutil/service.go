@@ -0,0 +1,59 @@
+package appengineutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// maxServiceNameLength is the maximum length of an App Engine service name.
+const maxServiceNameLength = 63
+
+// serviceNameHashLength is the length of the hash suffix of the truncated
+// service names.
+const serviceNameHashLength = 8
+
+// SanitizeServiceName converts name to a valid App Engine service name: at
+// most 63 lowercase letters, digits and hyphens, starting with a letter and
+// not ending with a hyphen. Invalid characters are replaced with hyphens.
+// "-dot-" separates the service from the version and the app in the
+// hostnames, it is replaced with a hyphen. Longer names are truncated and
+// suffixed with a hash of name, so that names sharing a prefix do not end
+// up deployed to the same service.
+func SanitizeServiceName(name string) string {
+	var b strings.Builder
+
+	hyphen := false
+
+	for _, r := range strings.ToLower(name) {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9' && b.Len() > 0:
+			b.WriteRune(r)
+			hyphen = false
+		case b.Len() > 0 && !hyphen:
+			// Replace any sequence of invalid characters with a single
+			// hyphen, leading invalid characters are dropped.
+			b.WriteRune('-')
+			hyphen = true
+		}
+	}
+
+	s := b.String()
+
+	// Replacing "-dot-dot-" once would leave "-dot-".
+	for strings.Contains(s, "-dot-") {
+		s = strings.ReplaceAll(s, "-dot-", "-")
+	}
+
+	s = strings.TrimRight(s, "-")
+	if len(s) <= maxServiceNameLength {
+		return s
+	}
+
+	sum := sha256.Sum256([]byte(name))
+	hash := hex.EncodeToString(sum[:])[:serviceNameHashLength]
+
+	s = strings.TrimRight(s[:maxServiceNameLength-len(hash)-1], "-")
+
+	return s + "-" + hash
+}
@@ -0,0 +1,35 @@
+package appengineutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSanitizeServiceName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{name: "api", want: "api"},
+		{name: "api-pr-123", want: "api-pr-123"},
+		{name: "API-Feature/New_Login", want: "api-feature-new-login"},
+		{name: "api--feature..x", want: "api-feature-x"},
+		{name: "123-api", want: "api"},
+		{name: "-api-", want: "api"},
+		{name: "api-fix.dot.parser", want: "api-fix-parser"},
+		{name: "api-dot-dot-x", want: "api-x"},
+		{name: "dotnet-api", want: "dotnet-api"},
+		{name: strings.Repeat("a", 63), want: strings.Repeat("a", 63)},
+		{name: "api-" + strings.Repeat("a", 70), want: "api-" + strings.Repeat("a", 50) + "-b4f1dacf"},
+		{name: strings.Repeat("a", 62) + "-b", want: strings.Repeat("a", 54) + "-0a2ffb18"},
+		{name: strings.Repeat("a", 53) + "-" + strings.Repeat("b", 10), want: strings.Repeat("a", 53) + "-6a30f87a"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SanitizeServiceName(tt.name); got != tt.want {
+				t.Errorf("SanitizeServiceName() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package appengineutil
+
+import (
+	"strconv"
+
+	sdk "github.com/hashicorp/waypoint-plugin-sdk/proto/gen"
+)
+
+// OverallHealth sums the health of the resources up: READY when they are
+// all ready, DOWN when they are all down and PARTIAL otherwise.
+func OverallHealth(resources []*sdk.StatusReport_Resource) (sdk.StatusReport_Health, string) {
+	if len(resources) == 0 {
+		return sdk.StatusReport_UNKNOWN, "No resource to report on"
+	}
+
+	var ready, down int
+
+	for _, r := range resources {
+		switch r.Health {
+		case sdk.StatusReport_READY:
+			ready++
+		case sdk.StatusReport_DOWN:
+			down++
+		}
+	}
+
+	message := strconv.Itoa(ready) + " of " + strconv.Itoa(len(resources)) + " resources are ready"
+
+	switch {
+	case ready == len(resources):
+		return sdk.StatusReport_READY, message
+	case down == len(resources):
+		return sdk.StatusReport_DOWN, message
+	default:
+		return sdk.StatusReport_PARTIAL, message
+	}
+}
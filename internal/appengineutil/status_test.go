@@ -0,0 +1,58 @@
+package appengineutil
+
+import (
+	"testing"
+
+	sdk "github.com/hashicorp/waypoint-plugin-sdk/proto/gen"
+)
+
+func TestOverallHealth(t *testing.T) {
+	ready := &sdk.StatusReport_Resource{Health: sdk.StatusReport_READY}
+	partial := &sdk.StatusReport_Resource{Health: sdk.StatusReport_PARTIAL}
+	down := &sdk.StatusReport_Resource{Health: sdk.StatusReport_DOWN}
+
+	tests := []struct {
+		name        string
+		resources   []*sdk.StatusReport_Resource
+		want        sdk.StatusReport_Health
+		wantMessage string
+	}{
+		{
+			name:        "no resources",
+			want:        sdk.StatusReport_UNKNOWN,
+			wantMessage: "No resource to report on",
+		},
+		{
+			name:        "all ready",
+			resources:   []*sdk.StatusReport_Resource{ready, ready},
+			want:        sdk.StatusReport_READY,
+			wantMessage: "2 of 2 resources are ready",
+		},
+		{
+			name:        "all down",
+			resources:   []*sdk.StatusReport_Resource{down, down},
+			want:        sdk.StatusReport_DOWN,
+			wantMessage: "0 of 2 resources are ready",
+		},
+		{
+			name:        "some down",
+			resources:   []*sdk.StatusReport_Resource{ready, down},
+			want:        sdk.StatusReport_PARTIAL,
+			wantMessage: "1 of 2 resources are ready",
+		},
+		{
+			name:        "some partial",
+			resources:   []*sdk.StatusReport_Resource{partial, down},
+			want:        sdk.StatusReport_PARTIAL,
+			wantMessage: "0 of 2 resources are ready",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, message := OverallHealth(tt.resources)
+			if got != tt.want || message != tt.wantMessage {
+				t.Errorf("OverallHealth() = %v, %q, want %v, %q", got, message, tt.want, tt.wantMessage)
+			}
+		})
+	}
+}
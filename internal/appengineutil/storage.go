@@ -0,0 +1,48 @@
+package appengineutil
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+const storageHost = "storage.googleapis.com"
+
+// ParseObjectURL parses the bucket and object names out of a Cloud Storage
+// URL. Both the gs://bucket/object and the
+// https://storage.googleapis.com/bucket/object forms are accepted.
+func ParseObjectURL(rawURL string) (bucket, object string, err error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "", err
+	}
+
+	var p string
+
+	switch {
+	case u.Scheme == "gs":
+		bucket = u.Host
+		p = u.Path
+	case (u.Scheme == "https" || u.Scheme == "http") && u.Host == storageHost:
+		split := strings.SplitN(strings.TrimPrefix(u.Path, "/"), "/", 2)
+		bucket = split[0]
+		if len(split) == 2 {
+			p = split[1]
+		}
+	default:
+		return "", "", fmt.Errorf("%q is not a Google Cloud Storage URL", rawURL)
+	}
+
+	object = strings.TrimPrefix(p, "/")
+	if bucket == "" || object == "" {
+		return "", "", fmt.Errorf("%q does not reference a Google Cloud Storage object", rawURL)
+	}
+
+	return bucket, object, nil
+}
+
+// ObjectURL returns the URL of an object in the form expected by App Engine
+// deployments: https://storage.googleapis.com/bucket/object.
+func ObjectURL(bucket, object string) string {
+	return "https://" + storageHost + "/" + bucket + "/" + object
+}
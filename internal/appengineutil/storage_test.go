@@ -0,0 +1,50 @@
+package appengineutil
+
+import (
+	"testing"
+)
+
+func TestParseObjectURL(t *testing.T) {
+	tests := []struct {
+		url        string
+		wantBucket string
+		wantObject string
+		wantErr    bool
+	}{
+		{
+			url:        "gs://bucket/artifacts/webapp/main.zip",
+			wantBucket: "bucket",
+			wantObject: "artifacts/webapp/main.zip",
+		},
+		{
+			url:        "https://storage.googleapis.com/bucket/artifacts/webapp/main.zip",
+			wantBucket: "bucket",
+			wantObject: "artifacts/webapp/main.zip",
+		},
+		{
+			url:     "https://storage.googleapis.com/bucket",
+			wantErr: true,
+		},
+		{
+			url:     "gs://bucket/",
+			wantErr: true,
+		},
+		{
+			url:     "https://example.com/bucket/main.zip",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			bucket, object, err := ParseObjectURL(tt.url)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseObjectURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if bucket != tt.wantBucket || object != tt.wantObject {
+				t.Errorf("ParseObjectURL() = %v, %v, want %v, %v", bucket, object, tt.wantBucket, tt.wantObject)
+			}
+		})
+	}
+}
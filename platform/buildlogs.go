@@ -0,0 +1,203 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/cloudbuild/v1"
+	"google.golang.org/api/option"
+	"google.golang.org/api/storage/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+// waitForBuild waits for the version create operation to finish while
+// streaming the Cloud Build logs of the version build to the UI.
+func waitForBuild(
+	ctx context.Context,
+	ui terminal.UI,
+	client appengineutil.Client,
+	project string,
+	op *appengine.Operation,
+	opts ...option.ClientOption,
+) (*appengine.Operation, error) {
+	sg := ui.StepGroup()
+	defer sg.Wait()
+
+	step := sg.Add("Building new version on Cloud Build '" + op.Name + "'")
+	defer step.Abort()
+
+	logs := &buildLogs{project: project, w: step.TermOutput(), opts: opts}
+	logs.progress(ctx, op)
+
+	op, err := appengineutil.WaitForOperationWithProgress(ctx, client, op, func(op *appengine.Operation) {
+		logs.progress(ctx, op)
+	})
+	if err != nil {
+		step.Update("Error fetching the version build status")
+		return nil, err
+	}
+
+	logs.flush(ctx)
+
+	if err := appengineutil.BuildError(op); err != nil {
+		step.Update("Build error")
+
+		if logs.buildID == "" {
+			return nil, err
+		}
+
+		fmt.Fprintf(step.TermOutput(), "Build logs: %s\n", logs.consoleURL())
+
+		return nil, appengineutil.Annotate(err, "build logs: "+logs.consoleURL())
+	}
+
+	step.Update("New version built on Cloud Build")
+	step.Done()
+
+	return op, nil
+}
+
+// buildLogs streams the logs Cloud Build writes to its logs bucket.
+type buildLogs struct {
+	project string
+	w       io.Writer
+	opts    []option.ClientOption
+
+	buildID        string
+	bucket, object string
+	offset         int64
+	partial        []byte
+
+	cloudbuildService *cloudbuild.Service
+	storageService    *storage.Service
+	disabled          bool
+}
+
+// progress writes the log lines produced since the last call. Log streaming
+// is a best effort, errors disable it without failing the deployment.
+func (l *buildLogs) progress(ctx context.Context, op *appengine.Operation) {
+	if l.disabled {
+		return
+	}
+
+	if err := l.poll(ctx, op); err != nil {
+		fmt.Fprintf(l.w, "Unable to stream the build logs: %s\n", err)
+		l.disabled = true
+	}
+}
+
+// flush writes the remaining logs once the build finished.
+func (l *buildLogs) flush(ctx context.Context) {
+	if l.disabled || l.object == "" {
+		return
+	}
+
+	if err := l.read(ctx); err != nil {
+		return
+	}
+
+	if len(l.partial) > 0 {
+		l.partial = append(l.partial, '\n')
+		_, _ = l.w.Write(l.partial)
+		l.partial = nil
+	}
+}
+
+func (l *buildLogs) poll(ctx context.Context, op *appengine.Operation) error {
+	if l.buildID == "" {
+		buildID, err := appengineutil.CloudBuildID(op)
+		if err != nil || buildID == "" {
+			return err
+		}
+
+		l.buildID = buildID
+	}
+
+	if l.object == "" {
+		if err := l.locate(ctx); err != nil {
+			return err
+		}
+	}
+
+	return l.read(ctx)
+}
+
+// locate finds the object the build logs are written to.
+func (l *buildLogs) locate(ctx context.Context) error {
+	var err error
+
+	if l.cloudbuildService == nil {
+		if l.cloudbuildService, err = cloudbuild.NewService(ctx, l.opts...); err != nil {
+			return err
+		}
+	}
+
+	if l.storageService == nil {
+		if l.storageService, err = storage.NewService(ctx, l.opts...); err != nil {
+			return err
+		}
+	}
+
+	build, err := l.cloudbuildService.Projects.Builds.Get(l.project, l.buildID).Context(ctx).Do()
+	if err != nil {
+		return appengineutil.APIError(err)
+	}
+
+	if build.LogsBucket == "" {
+		return errors.New("the build has no logs bucket")
+	}
+
+	l.bucket = strings.TrimPrefix(build.LogsBucket, "gs://")
+	l.object = "log-" + l.buildID + ".txt"
+
+	return nil
+}
+
+// read writes the complete lines appended to the logs since the last read.
+func (l *buildLogs) read(ctx context.Context) error {
+	getCall := l.storageService.Objects.Get(l.bucket, l.object)
+	getCall.Header().Set("Range", fmt.Sprintf("bytes=%d-", l.offset))
+
+	resp, err := getCall.Context(ctx).Download()
+	if err != nil {
+		// The logs object does not exist until the build starts and
+		// there is nothing to read when no line was added.
+		err = appengineutil.APIError(err)
+		if errors.Is(err, appengineutil.ErrNotFound) || status.Code(err) == codes.OutOfRange {
+			return nil
+		}
+
+		return err
+	}
+	defer resp.Body.Close()
+
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	l.offset += int64(len(b))
+	l.partial = append(l.partial, b...)
+
+	if i := bytes.LastIndexByte(l.partial, '\n'); i >= 0 {
+		_, _ = l.w.Write(l.partial[:i+1])
+		l.partial = append([]byte(nil), l.partial[i+1:]...)
+	}
+
+	return nil
+}
+
+// consoleURL returns the link to the build in the Google Cloud Console.
+func (l *buildLogs) consoleURL() string {
+	return "https://console.cloud.google.com/cloud-build/builds/" + l.buildID + "?project=" + l.project
+}
@@ -0,0 +1,107 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+// recordStep is a terminal.Step recording the writes to its output.
+type recordStep struct {
+	writes []string
+}
+
+func (s *recordStep) TermOutput() io.Writer { return s }
+
+func (s *recordStep) Write(p []byte) (int, error) {
+	s.writes = append(s.writes, string(p))
+	return len(p), nil
+}
+
+func (s *recordStep) Update(string, ...interface{}) {}
+
+func (s *recordStep) Status(string) {}
+
+func (s *recordStep) Done() {}
+
+func (s *recordStep) Abort() {}
+
+func Test_waitForBuild(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		failed bool
+		want   []string
+	}{
+		{
+			name:   "logs streamed",
+			chunks: []string{"Step 1\nSte", "p 2\n", "Step 3"},
+			want:   []string{"Step 1\n", "Step 2\n", "Step 3\n"},
+		},
+		{
+			name:   "logs streamed before a failure",
+			chunks: []string{"Step 1\nSte", "p 2\n", "Step 3"},
+			failed: true,
+			want: []string{
+				"Step 1\n", "Step 2\n", "Step 3\n",
+				"Build logs: https://console.cloud.google.com/cloud-build/builds/build-1?project=" + testProject + "\n",
+			},
+		},
+		{
+			name: "no logs",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := newTestServer(t)
+			fake.AddBuildLogs(testProject, testService, tt.chunks...)
+
+			if tt.failed {
+				fake.FailBuilds(testProject, testService, "Build failed")
+			}
+
+			client, err := appengineutil.NewClient(ctx, fake.ClientOptions()...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			op, err := client.CreateVersion(ctx, testProject, testService, &appengine.Version{Id: "v1", Runtime: "go114"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			step := &recordStep{}
+			ui := &stepUI{UI: terminal.NonInteractiveUI(ctx), step: step}
+
+			_, err = waitForBuild(ctx, ui, client, testProject, op, fake.ClientOptions()...)
+			if tt.failed {
+				// The status of the build failure is kept for Waypoint.
+				s, ok := status.FromError(err)
+				if !ok || s.Code() != codes.FailedPrecondition || !errors.Is(err, appengineutil.ErrBuildFailed) {
+					t.Fatalf("waitForBuild() error = %v, want a build failure", err)
+				}
+
+				if !strings.Contains(s.Message(), "/cloud-build/builds/build-1") {
+					t.Errorf("waitForBuild() error = %v, want the build logs link", err)
+				}
+			} else if err != nil {
+				t.Fatalf("waitForBuild() error = %v", err)
+			}
+
+			if fmt.Sprint(step.writes) != fmt.Sprint(tt.want) {
+				t.Errorf("waitForBuild() writes = %q, want %q", step.writes, tt.want)
+			}
+		})
+	}
+}
@@ -4,20 +4,26 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
 	"time"
 
+	"github.com/hashicorp/waypoint-plugin-sdk/component"
+	"github.com/hashicorp/waypoint-plugin-sdk/framework/resource"
 	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
 	"github.com/sharkyze/waypoint-plugin-cloudstorage/registry"
 	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/option"
 
 	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
 )
 
 type DeployConfig struct {
 	Project string `hcl:"project"`
-	Service string `hcl:"service"`
+	// Service: Service to deploy to. Not needed when service blocks are
+	// configured.
+	Service string `hcl:"service,optional"`
 	// Runtime: Desired runtime. Example: go114.
-	Runtime string `hcl:"runtime"`
+	Runtime string `hcl:"runtime,optional"`
 	// InstanceClass: Instance class that is used to run this version. Valid
 	// values are: AutomaticScaling: F1, F2, F4, F4_1G ManualScaling or
 	// BasicScaling: B1, B2, B4, B8, B4_1GDefaults to F1 for
@@ -27,6 +33,77 @@ type DeployConfig struct {
 	RuntimeMainExecutablePath string            `hcl:"main,optional"`
 	AutomaticScaling          *automaticScaling `hcl:"automatic_scaling,block"`
 	Handlers                  handlers          `hcl:"handlers,block"`
+	// SourceMode: How the version source is deployed. Valid values are
+	// "zip" to deploy the artifact as is and "files" to deploy a manifest
+	// of the artifact files, only uploading the files that changed since
+	// the previous deployments. Defaults to "zip".
+	SourceMode string `hcl:"source_mode,optional"`
+	// StagingBucket: Bucket the files are uploaded to when SourceMode is
+	// "files". Defaults to the App Engine staging bucket.
+	StagingBucket string `hcl:"staging_bucket,optional"`
+	// CleanupOnFailure: Delete the version when the deployment fails after
+	// it was created, for example when the build fails. Defaults to true.
+	CleanupOnFailure *bool `hcl:"cleanup_on_failure,optional"`
+	// DestroyPolicy: What to do when destroying a version that still
+	// receives traffic. Valid values are "fail" to refuse to destroy it and
+	// "fallback" to move its traffic to DestroyFallbackVersion first.
+	// Defaults to "fail".
+	DestroyPolicy string `hcl:"destroy_policy,optional"`
+	// DestroyFallbackVersion: Version receiving the traffic of the
+	// destroyed version when DestroyPolicy is "fallback". It must exist in
+	// every service, service blocks can set their own.
+	DestroyFallbackVersion string `hcl:"destroy_fallback_version,optional"`
+	// DeleteServiceWhenEmpty: Delete the service when its last version is
+	// destroyed. The default service is never deleted.
+	DeleteServiceWhenEmpty bool `hcl:"delete_service_when_empty,optional"`
+	// KeepVersions: Number of previous versions kept in each service once
+	// a deployment succeeds, the older ones are deleted. The deployed
+	// version and the versions receiving traffic are always kept. Defaults
+	// to keeping all the versions.
+	KeepVersions *int `hcl:"keep_versions,optional"`
+	// StopPreviousVersions: Stop the previous versions of each service
+	// which receive no traffic once a deployment succeeds, so that their
+	// instances stop running. They are started again if the deployment
+	// fails, destroying the deployment leaves them stopped.
+	StopPreviousVersions bool `hcl:"stop_previous_versions,optional"`
+	// ServiceTemplate: Template of the name of the service to deploy to,
+	// for example "${service}-${branch}" to deploy each branch to its own
+	// service. ${service} is replaced with Service and ${branch} with the
+	// current git branch. The result is sanitized to a valid service name,
+	// services resolving to the same name are rejected.
+	ServiceTemplate string `hcl:"service_template,optional"`
+	// Branch: Branch replacing ${branch} in ServiceTemplate. Defaults to
+	// the branch set by the CI system in GITHUB_HEAD_REF,
+	// CI_COMMIT_REF_NAME, BRANCH_NAME or CIRCLE_BRANCH, else to the
+	// current git branch. Deploying from a detached HEAD fails without it.
+	Branch string `hcl:"branch,optional"`
+	// Indexes: Datastore indexes created if they do not exist yet, before
+	// the versions are deployed. Cron jobs and task queues are applied on
+	// release.
+	Indexes indexes `hcl:"index,block"`
+	// DryRun: Print the version that would be created instead of deploying
+	// it, no resource is created or updated. Can also be enabled with the
+	// WAYPOINT_APPENGINE_DRY_RUN environment variable.
+	DryRun bool `hcl:"dry_run,optional"`
+	// Services: Services deployed concurrently from the same artifact,
+	// instead of the single Service. Their settings default to the ones
+	// above and their env variables are merged with the ones above.
+	Services []serviceConfig `hcl:"service,block"`
+	// Parallelism: Maximum number of services deployed at the same time.
+	// Defaults to 3.
+	Parallelism int `hcl:"parallelism,optional"`
+	// MetadataEnvVars: Expose the deployment to the running app with the
+	// WAYPOINT_DEPLOYMENT_ID, WAYPOINT_APP, WAYPOINT_WORKSPACE, GIT_COMMIT
+	// and WAYPOINT_ARTIFACT_SOURCE env variables. The configured env
+	// variables take precedence. Defaults to true, unless ReuseVersions is
+	// set: the deployment id differs on every deployment, a version
+	// exposing it would never be reused.
+	MetadataEnvVars *bool `hcl:"metadata_env_variables,optional"`
+	// ReuseVersions: Reuse the version of a previous deployment when the
+	// artifact and the configuration did not change instead of creating a
+	// new version. MetadataEnvVars should not be enabled along with it.
+	// Defaults to false.
+	ReuseVersions bool `hcl:"reuse_versions,optional"`
 }
 
 type handler struct {
@@ -137,6 +214,28 @@ type Handlers struct {
 
 type Platform struct {
 	config DeployConfig
+
+	// clientOptions are passed to the Google API clients, tests use them
+	// to point the clients to a fake server.
+	clientOptions []option.ClientOption
+
+	// client is the App Engine client, created from the client options on
+	// first use unless set.
+	client appengineutil.Client
+}
+
+// appengineClient returns the App Engine client of the platform.
+func (p *Platform) appengineClient(ctx context.Context) (appengineutil.Client, error) {
+	if p.client == nil {
+		client, err := appengineutil.NewClient(ctx, p.clientOptions...)
+		if err != nil {
+			return nil, err
+		}
+
+		p.client = client
+	}
+
+	return p.client, nil
 }
 
 // Config implements Configurable.
@@ -153,12 +252,45 @@ func (p *Platform) ConfigSet(config interface{}) error {
 	}
 
 	// validate the config
-	if c.Runtime == "" {
-		return errors.New("Runtime should not be empty")
+	if c.Service == "" && len(c.Services) == 0 {
+		return errors.New("Service should not be empty")
 	}
 
-	if c.Service == "" {
-		return errors.New("Service should not be empty")
+	if err := c.validateServices(); err != nil {
+		return err
+	}
+
+	switch c.SourceMode {
+	case "", sourceModeZip, sourceModeFiles:
+	default:
+		return fmt.Errorf("Source mode should be either %q or %q", sourceModeZip, sourceModeFiles)
+	}
+
+	if err := c.Indexes.validate(); err != nil {
+		return err
+	}
+
+	if c.ReuseVersions && c.MetadataEnvVars != nil && *c.MetadataEnvVars {
+		return errors.New("Metadata env variables should not be enabled along with version reuse")
+	}
+
+	if c.KeepVersions != nil && *c.KeepVersions < 0 {
+		return errors.New("Keep versions should not be negative")
+	}
+
+	switch c.DestroyPolicy {
+	case "", destroyPolicyFail:
+	case destroyPolicyFallback:
+		for _, s := range c.serviceConfigs() {
+			if s.DestroyFallbackVersion == "" {
+				return fmt.Errorf(
+					"Destroy fallback version of service %q should not be empty when the destroy policy is \"fallback\"",
+					s.Name,
+				)
+			}
+		}
+	default:
+		return fmt.Errorf("Destroy policy should be either %q or %q", destroyPolicyFail, destroyPolicyFallback)
 	}
 
 	return nil
@@ -198,81 +330,361 @@ func (p *Platform) DeployFunc() interface{} {
 // returns an error to the user.
 func (p *Platform) deploy(
 	ctx context.Context,
+	src *component.Source,
+	job *component.JobInfo,
+	dc *component.DeploymentConfig,
 	artifact *registry.Artifact,
+	labels *component.LabelSet,
 	ui terminal.UI,
 ) (*Deployment, error) {
 	st := ui.Status()
 	defer st.Close()
 
-	st.Update("Creating new App Engine version '" + artifact.Source + "'")
+	project := p.config.Project
+
+	services, configServices, err := p.resolveServices(ctx, src, labels)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error resolving the services")
+		return nil, err
+	}
+
+	source, err := preflight(ctx, st, project, artifact.Source, p.clientOptions...)
+	if err != nil {
+		return nil, err
+	}
 
-	appengineService, err := appengine.NewService(ctx)
+	client, err := p.appengineClient(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	service := p.config.Service
+	var refs *versionRefs
+
+	// Nothing is uploaded nor recorded on a dry run.
+	if !p.dryRun() {
+		// The manifest is built once for all the services.
+		if p.config.SourceMode == sourceModeFiles {
+			source.files, err = filesManifest(ctx, st, client, project, p.config.StagingBucket, source.zipInfo, p.clientOptions...)
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		refs, err = p.deploymentRefs(ctx, client, dc)
+		if err != nil {
+			st.Step(terminal.StatusError, "Error fetching the App Engine staging bucket")
+			return nil, err
+		}
+
+		// The indexes are not part of the versions, they are applied first
+		// so that a failure does not leave new versions behind.
+		if err := p.deployIndexes(ctx, st, project); err != nil {
+			return nil, err
+		}
+	}
+
+	var metadata map[string]string
+	if p.metadataEnvVars() {
+		metadata = metadataEnvVars(ctx, src, job, dc, artifact.Source)
+	}
+
+	// The services write their own status to the UI, no other output may
+	// be written while the status is live.
+	st.Close()
+
+	var versions []*Deployment_Version
+
+	if len(services) == 1 {
+		version, _, err := p.deployService(ctx, ui, client, services[0], source, refs, metadata)
+		if err != nil {
+			return nil, err
+		}
+
+		versions = []*Deployment_Version{version}
+	} else {
+		versions, err = p.deployServices(ctx, ui, client, services, source, refs, metadata)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, v := range versions {
+		v.ConfigService = configServices[v.Service]
+	}
+
+	return &Deployment{
+		VersionId: versions[0].VersionId,
+		Project:   project,
+		Service:   versions[0].Service,
+		Versions:  versions,
+		Ref:       refs.ref,
+	}, nil
+}
+
+// resolveServices returns the services to deploy, named after the service
+// template, and the configured name of each of them. The configured names
+// are recorded in the deployment, destroy looks up the settings of the
+// services with them.
+func (p *Platform) resolveServices(
+	ctx context.Context,
+	src *component.Source,
+	labels *component.LabelSet,
+) ([]serviceConfig, map[string]string, error) {
+	services := p.config.serviceConfigs()
+	configServices := make(map[string]string, len(services))
+
+	labelEnv, err := labelEnvVars(labels)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for i := range services {
+		name, err := resolveService(ctx, p.config.ServiceTemplate, services[i].Name, p.config.Branch, src.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// Distinct services may resolve to the same name once sanitized,
+		// they would be deployed on top of each other.
+		if other, ok := configServices[name]; ok {
+			return nil, nil, fmt.Errorf("services %q and %q both resolve to service %q", other, services[i].Name, name)
+		}
+
+		configServices[name] = services[i].Name
+		services[i].Name = name
+
+		// The labels are stored on the versions to trace them back to
+		// the deployment, the configured env variables take precedence.
+		services[i].EnvVars = withEnvVars(labelEnv, services[i].EnvVars)
+	}
+
+	return services, configServices, nil
+}
+
+// deploymentRefs returns the references held by the deployment, named after
+// its Waypoint id.
+func (p *Platform) deploymentRefs(
+	ctx context.Context,
+	client appengineutil.Client,
+	dc *component.DeploymentConfig,
+) (*versionRefs, error) {
+	var ref string
+	if dc != nil {
+		ref = dc.Id
+	}
+
+	if ref == "" {
+		var err error
+		if ref, err = newRef(); err != nil {
+			return nil, err
+		}
+	}
+
+	return newVersionRefs(ctx, client, p.config.Project, p.config.StagingBucket, ref, p.clientOptions...)
+}
+
+// versionSource is the source the versions are deployed from, shared by the
+// services of the deployment.
+type versionSource struct {
+	// zipInfo is the zip artifact.
+	zipInfo *appengine.ZipInfo
+
+	// objectGeneration is the generation of the artifact object, it changes
+	// when the artifact is overwritten at the same URL.
+	objectGeneration int64
+
+	// files is the manifest of the artifact files when SourceMode is
+	// "files", nil otherwise.
+	files map[string]appengine.FileInfo
+}
+
+// deployment returns the deployment of a version from the source.
+func (s *versionSource) deployment() *appengine.Deployment {
+	if s.files != nil {
+		return &appengine.Deployment{Files: s.files}
+	}
+
+	return &appengine.Deployment{Zip: s.zipInfo}
+}
+
+// url returns the URL of the artifact object at its generation, in the
+// gs://bucket/object#generation form.
+func (s *versionSource) url() string {
+	return s.zipInfo.SourceUrl + "#" + strconv.FormatInt(s.objectGeneration, 10)
+}
+
+// deployService deploys a version of the service, or with ReuseVersions
+// finds an identical version to reuse, and records that the deployment uses it in refs. It
+// returns the manager of the resources of the deployment in the service,
+// their state is recorded in the returned version.
+func (p *Platform) deployService(
+	ctx context.Context,
+	ui terminal.UI,
+	client appengineutil.Client,
+	sc serviceConfig,
+	source *versionSource,
+	refs *versionRefs,
+	metadata map[string]string,
+) (*Deployment_Version, *resource.Manager, error) {
+	st := ui.Status()
+	defer st.Close()
+
 	project := p.config.Project
+	service := sc.Name
 	versionID := time.Now().Format("20060102t150405")
-	sourceURL := artifact.Source
 
-	aev := appengine.Version{
+	aev := newVersion(sc, versionID, metadata)
+
+	gen, err := generation(source.url(), aev)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if p.dryRun() {
+		// Comparing only reads the serving version.
+		printVersionDiff(ctx, st, client, project, service, aev)
+
+		aev.EnvVariables[generationEnvVar] = gen
+		aev.Deployment = source.deployment()
+
+		st.Step(terminal.StatusOK, "Dry run, App Engine version '"+versionID+"' would be created in service '"+service+"' with")
+		st.Close()
+
+		if err := printVersion(ui, aev); err != nil {
+			return nil, nil, err
+		}
+
+		return nil, nil, errDryRun
+	}
+
+	var existing *appengine.Version
+
+	if p.config.ReuseVersions {
+		st.Update("Looking for an identical App Engine version")
+
+		existing, err = findGeneration(ctx, client, project, service, gen)
+		if err != nil {
+			st.Step(terminal.StatusError, "Error listing the App Engine versions")
+			return nil, nil, err
+		}
+	}
+
+	var plan *versionPlan
+
+	if existing != nil {
+		// The version is shared with the deployments which already use
+		// it, it is only deleted with the last of them.
+		st.Step(terminal.StatusOK, "Artifact and config unchanged, reusing App Engine version '"+existing.Id+"'")
+
+		plan = &versionPlan{version: existing, reused: true}
+	} else {
+		printVersionDiff(ctx, st, client, project, service, aev)
+
+		aev.EnvVariables[generationEnvVar] = gen
+		aev.Deployment = source.deployment()
+
+		plan = &versionPlan{version: aev}
+	}
+
+	// Resources write their own status to the UI, no other output may be
+	// written while the status is live.
+	st.Close()
+
+	rm := p.serviceResources(client, refs, project, service, sc.DestroyFallbackVersion, plan)
+
+	if err, rollbackErr := createResources(rm, ctx, ui); err != nil {
+		switch {
+		case !plan.created && rollbackErr != nil:
+			return nil, nil, appengineutil.Annotate(err, "rolling back the deployment also failed: "+rollbackErr.Error())
+		case !plan.created:
+			return nil, nil, err
+		case !p.cleanupOnFailure():
+			return nil, nil, appengineutil.Annotate(err, "the failed version '"+versionID+"' was not deleted")
+		case rollbackErr != nil:
+			return nil, nil, appengineutil.Annotate(err, "deleting the failed version also failed: "+rollbackErr.Error())
+		default:
+			// The resources created before the failure, for example a
+			// version that failed to build, were destroyed so they do not
+			// count against the versions quota.
+			return nil, nil, appengineutil.Annotate(err, "the failed version '"+versionID+"' was deleted")
+		}
+	}
+
+	if !plan.reused {
+		st = ui.Status()
+		defer st.Close()
+
+		st.Step(terminal.StatusOK, "New service version created '"+versionID+"'")
+	}
+
+	version := &Deployment_Version{
+		Service:       service,
+		VersionId:     plan.version.Id,
+		ResourceState: rm.State(),
+	}
+
+	return version, rm, nil
+}
+
+// newVersion renders the version of the service deployed with the given id
+// and deployment metadata, without its generation nor its source.
+func newVersion(sc serviceConfig, versionID string, metadata map[string]string) *appengine.Version {
+	aev := &appengine.Version{
 		ApiConfig:                 nil,
-		AutomaticScaling:          p.config.AutomaticScaling.toAE(),
+		AutomaticScaling:          sc.AutomaticScaling.toAE(),
 		BasicScaling:              nil,
 		BetaSettings:              nil,
 		BuildEnvVariables:         nil,
 		DefaultExpiration:         "",
-		Deployment:                &appengine.Deployment{Zip: &appengine.ZipInfo{SourceUrl: sourceURL}},
+		Deployment:                nil,
 		EndpointsApiService:       nil,
 		Entrypoint:                &appengine.Entrypoint{Shell: "", ForceSendFields: []string{"Shell"}},
 		Env:                       "standard",
-		EnvVariables:              p.config.EnvVars,
+		EnvVariables:              map[string]string{},
 		ErrorHandlers:             nil,
-		Handlers:                  p.config.Handlers.toAE(),
+		Handlers:                  sc.Handlers.toAE(),
 		HealthCheck:               nil,
 		Id:                        versionID,
 		InboundServices:           nil,
-		InstanceClass:             p.config.InstanceClass,
+		InstanceClass:             sc.InstanceClass,
 		Libraries:                 nil,
 		LivenessCheck:             nil,
 		ManualScaling:             nil,
 		NobuildFilesRegex:         "",
 		ReadinessCheck:            nil,
-		Runtime:                   p.config.Runtime,
+		Runtime:                   sc.Runtime,
 		RuntimeApiVersion:         "",
 		RuntimeChannel:            "",
-		RuntimeMainExecutablePath: p.config.RuntimeMainExecutablePath,
+		RuntimeMainExecutablePath: sc.RuntimeMainExecutablePath,
 		ServingStatus:             "STOPPED",
 		Threadsafe:                true,
 		Vm:                        false,
 		VpcAccessConnector:        nil,
 	}
 
-	createCall := appengineService.Apps.Services.Versions.Create(project, service, &aev)
-	createCall = createCall.Context(ctx)
-
-	op, err := createCall.Do()
-	if err != nil {
-		st.Step(terminal.StatusError, "Error creating new App Engine service version")
-		return nil, err
+	for k, v := range sc.EnvVars {
+		aev.EnvVariables[k] = v
 	}
 
-	st.Step(terminal.StatusOK, "App Engine version created '"+versionID+"'")
-	st.Update("Building new version on Cloud Build '" + op.Name + "'")
+	// The metadata is part of the generation like the labels: a version is
+	// only reused when its env variables describe this deployment.
+	setMissingEnvVars(aev.EnvVariables, metadata)
 
-	op, err = appengineutil.WaitForOperation(ctx, appengineService, op)
-	if err != nil {
-		st.Step(terminal.StatusError, "Error fetching the version build status")
-		return nil, err
-	}
+	return aev
+}
 
-	if op.Error != nil {
-		st.Step(terminal.StatusError, "Build error")
-		return nil, errors.New(op.Error.Message)
+// metadataEnvVars reports whether the deployment metadata should be exposed
+// to the running app.
+func (p *Platform) metadataEnvVars() bool {
+	if p.config.MetadataEnvVars == nil {
+		return !p.config.ReuseVersions
 	}
 
-	st.Step(terminal.StatusOK, "New service version created '"+versionID+"'")
+	return *p.config.MetadataEnvVars
+}
 
-	return &Deployment{VersionId: versionID, Project: project, Service: service}, nil
+// cleanupOnFailure reports whether the versions created by a failed
+// deployment should be deleted.
+func (p *Platform) cleanupOnFailure() bool {
+	return p.config.CleanupOnFailure == nil || *p.config.CleanupOnFailure
 }
@@ -0,0 +1,12 @@
+package platform
+
+// ServiceVersions returns the versions of the deployment, one per service.
+// Deployments recorded before services could be deployed together only have
+// VersionId and Service set.
+func (d *Deployment) ServiceVersions() []*Deployment_Version {
+	if len(d.Versions) > 0 {
+		return d.Versions
+	}
+
+	return []*Deployment_Version{{Service: d.Service, VersionId: d.VersionId}}
+}
@@ -3,13 +3,17 @@ package platform
 import (
 	"context"
 	"errors"
+	"strconv"
 
 	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
-	"google.golang.org/api/appengine/v1"
 
 	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
 )
 
+// defaultService is the name of the default App Engine service, it cannot
+// be deleted.
+const defaultService = "default"
+
 // DestroyFunc implements the Destroyer interface.
 func (p *Platform) DestroyFunc() interface{} {
 	return p.destroy
@@ -43,45 +47,118 @@ func (p *Platform) DestroyFunc() interface{} {
 // If an error is returned, Waypoint stops the execution flow and
 // returns an error to the user.
 func (p *Platform) destroy(ctx context.Context, ui terminal.UI, deployment *Deployment) error {
-	st := ui.Status()
-	defer st.Close()
-
-	project := deployment.Project
-	service := deployment.Service
-	versionID := deployment.VersionId
+	client, err := p.appengineClient(ctx)
+	if err != nil {
+		return err
+	}
 
-	st.Update(
-		"Deleting App Engine version '" +
-			"apps/" + project + "/services/" + service + "/versions/" + versionID +
-			"'",
+	refs, err := newVersionRefs(
+		ctx, client, deployment.Project, p.config.StagingBucket, deployment.Ref, p.clientOptions...,
 	)
-
-	appengineService, err := appengine.NewService(ctx)
 	if err != nil {
 		return err
 	}
 
-	deleteCall := appengineService.Apps.Services.Versions.Delete(project, service, versionID)
+	// The versions of all the services deployed together are destroyed
+	// together, a failure does not stop the others.
+	var errs []error
 
-	deleteCall = deleteCall.Context(ctx)
-	op, err := deleteCall.Do()
-	if err != nil {
-		st.Step(terminal.StatusError, "Error deleting App Engine version")
+	for _, v := range deployment.ServiceVersions() {
+		if err := p.destroyServiceResources(ctx, ui, client, refs, deployment.Project, v); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) > 0 {
+		return firstError(errs)
+	}
+
+	return nil
+}
+
+// destroyServiceResources destroys the resources the deployment manages in
+// the service of the version.
+func (p *Platform) destroyServiceResources(
+	ctx context.Context,
+	ui terminal.UI,
+	client appengineutil.Client,
+	refs *versionRefs,
+	project string,
+	v *Deployment_Version,
+) error {
+	state := v.ResourceState
+	if state == nil {
+		var err error
+		if state, err = legacyResourceState(v); err != nil {
+			return err
+		}
+	}
+
+	rm := p.serviceResources(client, refs, project, v.Service, p.config.destroyFallbackVersion(v.ConfigService), nil)
+	if err := rm.LoadState(state); err != nil {
 		return err
 	}
 
-	op, err = appengineutil.WaitForOperation(ctx, appengineService, op)
+	return rm.DestroyAll(ctx, ui)
+}
+
+// usedByOthers reports whether other deployments than the destroyed one
+// use the version.
+func usedByOthers(
+	ctx context.Context,
+	ui terminal.UI,
+	refs *versionRefs,
+	service string,
+	versionID string,
+) (bool, error) {
+	st := ui.Status()
+	defer st.Close()
+
+	st.Update("Checking the deployments using App Engine version '" + versionID + "'")
+
+	others, err := refs.others(ctx, service, versionID)
 	if err != nil {
-		st.Step(terminal.StatusError, "Error fetching delete operation status")
-		return err
+		st.Step(terminal.StatusError, "Error listing the references to the App Engine version")
+		return false, err
 	}
 
-	if op.Error != nil {
-		st.Step(terminal.StatusError, "Error deleting App Engine version")
-		return errors.New(op.Error.Message)
+	if len(others) > 0 {
+		st.Step(
+			terminal.StatusWarn,
+			"App Engine version '"+versionID+"' is still used by "+strconv.Itoa(len(others))+
+				" other deployment(s), it was not deleted",
+		)
+
+		return true, nil
 	}
 
-	st.Step(terminal.StatusOK, "App Engine Version deleted '"+versionID+"'")
+	return false, nil
+}
 
-	return nil
+// isLastVersion reports whether the version is the only version of the
+// service.
+func isLastVersion(
+	ctx context.Context,
+	client appengineutil.Client,
+	project string,
+	service string,
+	versionID string,
+) (bool, error) {
+	versions, err := client.ListVersions(ctx, project, service, "BASIC")
+	if err != nil {
+		// The service was already deleted, with the version.
+		if errors.Is(err, appengineutil.ErrNotFound) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	for _, v := range versions {
+		if v.Id != versionID {
+			return false, nil
+		}
+	}
+
+	return true, nil
 }
@@ -0,0 +1,61 @@
+package platform
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+// errDryRun is returned instead of a deployment in dry run mode, so the
+// release does not run. Waypoint reports it as a failure, its Aborted status
+// tells it apart from actual failures.
+var errDryRun error = dryRunError{}
+
+type dryRunError struct{}
+
+func (dryRunError) Error() string {
+	return "dry run, nothing was deployed"
+}
+
+// GRPCStatus converts the error to a gRPC status Waypoint can render.
+func (dryRunError) GRPCStatus() *status.Status {
+	return status.New(codes.Aborted, "Dry run, nothing was deployed")
+}
+
+// dryRunEnvVar enables the dry run mode without changing the configuration.
+const dryRunEnvVar = "WAYPOINT_APPENGINE_DRY_RUN"
+
+// dryRun reports whether the deployment should only print the version it
+// would create.
+func (p *Platform) dryRun() bool {
+	if p.config.DryRun {
+		return true
+	}
+
+	enabled, _ := strconv.ParseBool(os.Getenv(dryRunEnvVar))
+
+	return enabled
+}
+
+// printVersion prints the version spec field by field.
+func printVersion(ui terminal.UI, aev *appengine.Version) error {
+	fields, err := appengineutil.Flatten(aev)
+	if err != nil {
+		return err
+	}
+
+	tbl := terminal.NewTable("Field", "Value")
+	for _, f := range fields {
+		tbl.Rich([]string{f.Path, f.Value}, nil)
+	}
+
+	ui.Table(tbl)
+
+	return nil
+}
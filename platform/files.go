@@ -0,0 +1,203 @@
+package platform
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/option"
+	"google.golang.org/api/storage/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+const (
+	// sourceModeZip deploys the version from the zip artifact.
+	sourceModeZip = "zip"
+	// sourceModeFiles deploys the version from a manifest of the files
+	// contained in the zip artifact, uploaded to a content-addressed bucket.
+	sourceModeFiles = "files"
+)
+
+// filesManifest extracts the files of the zip artifact and uploads each of
+// them to the staging bucket, named after its SHA-1 like gcloud does. Files
+// that were uploaded by a previous deployment are skipped.
+func filesManifest(
+	ctx context.Context,
+	st terminal.Status,
+	client appengineutil.Client,
+	project string,
+	stagingBucket string,
+	zipInfo *appengine.ZipInfo,
+	opts ...option.ClientOption,
+) (map[string]appengine.FileInfo, error) {
+	bucket, object, err := appengineutil.ParseObjectURL(zipInfo.SourceUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	stagingBucket, err = stagingBucketName(ctx, client, project, stagingBucket)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error fetching the App Engine staging bucket")
+		return nil, err
+	}
+
+	storageService, err := storage.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	st.Update("Downloading artifact '" + zipInfo.SourceUrl + "'")
+
+	f, size, err := downloadObject(ctx, storageService, bucket, object)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error downloading the artifact")
+		return nil, err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	zr, err := zip.NewReader(f, size)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error reading the artifact")
+		return nil, err
+	}
+
+	files := make(map[string]appengine.FileInfo, len(zr.File))
+	uploaded := 0
+
+	for _, zf := range zr.File {
+		if zf.FileInfo().IsDir() {
+			continue
+		}
+
+		sum, err := zipFileSHA1(zf)
+		if err != nil {
+			return nil, err
+		}
+
+		st.Update("Uploading file '" + zf.Name + "'")
+
+		created, err := uploadIfMissing(ctx, storageService, stagingBucket, sum, zf)
+		if err != nil {
+			st.Step(terminal.StatusError, "Error uploading file '"+zf.Name+"'")
+			return nil, err
+		}
+
+		if created {
+			uploaded++
+		}
+
+		files[zf.Name] = appengine.FileInfo{
+			Sha1Sum:   sum,
+			SourceUrl: appengineutil.ObjectURL(stagingBucket, sum),
+		}
+	}
+
+	st.Step(
+		terminal.StatusOK,
+		"Uploaded "+strconv.Itoa(uploaded)+" of "+strconv.Itoa(len(files))+" files to '"+stagingBucket+"'",
+	)
+
+	return files, nil
+}
+
+// stagingBucketName returns the configured bucket, or the App Engine staging
+// bucket of the project if none is configured.
+func stagingBucketName(ctx context.Context, client appengineutil.Client, project, bucket string) (string, error) {
+	if bucket != "" {
+		return bucket, nil
+	}
+
+	app, err := client.GetApplication(ctx, project)
+	if err != nil {
+		return "", err
+	}
+
+	return app.CodeBucket, nil
+}
+
+// downloadObject downloads an object to a temporary file.
+func downloadObject(
+	ctx context.Context,
+	storageService *storage.Service,
+	bucket string,
+	object string,
+) (*os.File, int64, error) {
+	resp, err := storageService.Objects.Get(bucket, object).Context(ctx).Download()
+	if err != nil {
+		return nil, 0, appengineutil.APIError(err)
+	}
+	defer resp.Body.Close()
+
+	f, err := ioutil.TempFile("", "waypoint-appengine-*.zip")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	size, err := io.Copy(f, resp.Body)
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+
+		return nil, 0, err
+	}
+
+	return f, size, nil
+}
+
+// zipFileSHA1 returns the hex encoded SHA-1 of a file in a zip archive.
+func zipFileSHA1(zf *zip.File) (string, error) {
+	rc, err := zf.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+
+	h := sha1.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// uploadIfMissing uploads the zip file to the bucket as name unless an object
+// with that name already exists. It reports whether the object was created.
+func uploadIfMissing(
+	ctx context.Context,
+	storageService *storage.Service,
+	bucket string,
+	name string,
+	zf *zip.File,
+) (bool, error) {
+	_, err := storageService.Objects.Get(bucket, name).Context(ctx).Do()
+	if err == nil {
+		return false, nil
+	}
+
+	if err := appengineutil.APIError(err); !errors.Is(err, appengineutil.ErrNotFound) {
+		return false, err
+	}
+
+	rc, err := zf.Open()
+	if err != nil {
+		return false, err
+	}
+	defer rc.Close()
+
+	insertCall := storageService.Objects.Insert(bucket, &storage.Object{Name: name}).Media(rc)
+	if _, err := insertCall.Context(ctx).Do(); err != nil {
+		return false, appengineutil.APIError(err)
+	}
+
+	return true, nil
+}
@@ -0,0 +1,147 @@
+package platform
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+func Test_filesManifest(t *testing.T) {
+	files := map[string]string{
+		"main.go":         "package main\n",
+		"static/app.css":  "body {}\n",
+		"static/site.css": "body {}\n",
+	}
+
+	sha := func(data string) string {
+		sum := sha1.Sum([]byte(data))
+		return hex.EncodeToString(sum[:])
+	}
+
+	tests := []struct {
+		name          string
+		stagingBucket string
+		artifact      string
+		existing      []string
+		wantBucket    string
+		wantUploads   int
+		wantCode      codes.Code
+	}{
+		{
+			name:        "default staging bucket",
+			wantBucket:  "staging." + testProject + ".appspot.com",
+			wantUploads: 2,
+		},
+		{
+			name:          "configured staging bucket",
+			stagingBucket: "staging",
+			wantBucket:    "staging",
+			wantUploads:   2,
+		},
+		{
+			name:          "uploaded files are skipped",
+			stagingBucket: "staging",
+			existing:      []string{"package main\n"},
+			wantBucket:    "staging",
+			wantUploads:   1,
+		},
+		{
+			name:       "artifact not found",
+			artifact:   "missing.zip",
+			wantBucket: "staging." + testProject + ".appspot.com",
+			wantCode:   codes.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := newTestServer(t)
+
+			var buf bytes.Buffer
+
+			zw := zip.NewWriter(&buf)
+			for name, data := range files {
+				f, err := zw.Create(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				_, _ = f.Write([]byte(data))
+			}
+
+			if err := zw.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			fake.AddObject("artifacts", "files.zip", buf.Bytes())
+
+			for _, data := range tt.existing {
+				fake.AddObject(tt.wantBucket, sha(data), []byte(data))
+			}
+
+			client, err := appengineutil.NewClient(ctx, fake.ClientOptions()...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			st := terminal.NonInteractiveUI(ctx).Status()
+			defer st.Close()
+
+			artifact := tt.artifact
+			if artifact == "" {
+				artifact = "files.zip"
+			}
+
+			zipInfo := &appengine.ZipInfo{SourceUrl: appengineutil.ObjectURL("artifacts", artifact)}
+
+			got, err := filesManifest(ctx, st, client, testProject, tt.stagingBucket, zipInfo, fake.ClientOptions()...)
+			if code := status.Code(err); code != tt.wantCode {
+				t.Fatalf("filesManifest() error = %v, code %v, want %v", err, code, tt.wantCode)
+			}
+
+			if err != nil {
+				return
+			}
+
+			want := make(map[string]appengine.FileInfo, len(files))
+			for name, data := range files {
+				want[name] = appengine.FileInfo{
+					Sha1Sum:   sha(data),
+					SourceUrl: appengineutil.ObjectURL(tt.wantBucket, sha(data)),
+				}
+
+				if stored, ok := fake.Object(tt.wantBucket, sha(data)); !ok || string(stored) != data {
+					t.Errorf("filesManifest() object %q = %q, want %q", sha(data), stored, data)
+				}
+			}
+
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("filesManifest() = %v, want %v", got, want)
+			}
+
+			var uploads int
+
+			for _, r := range fake.Requests() {
+				if strings.HasPrefix(r, "POST /upload/") {
+					uploads++
+				}
+			}
+
+			if uploads != tt.wantUploads {
+				t.Errorf("filesManifest() uploaded %d files, want %d", uploads, tt.wantUploads)
+			}
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package platform
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/component"
+	"github.com/sharkyze/waypoint-plugin-cloudstorage/registry"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/option"
+	"google.golang.org/api/storage/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+// generationEnvVar is the env variable the generation of a version is
+// stored in. The generation is kept on the version itself to find it again
+// on the next deployments, per service, while the generation reported to
+// Waypoint identifies the deployment as a whole.
+const generationEnvVar = "WAYPOINT_APPENGINE_GENERATION"
+
+// GenerationFunc implements component.Generation.
+func (p *Platform) GenerationFunc() interface{} {
+	return p.deploymentGeneration
+}
+
+// deploymentGeneration hashes the generation of the version of each service
+// the deployment would create. Deployments of the same artifact with the
+// same configuration have the same generation, and reuse the same versions
+// with ReuseVersions.
+func (p *Platform) deploymentGeneration(
+	ctx context.Context,
+	src *component.Source,
+	job *component.JobInfo,
+	dc *component.DeploymentConfig,
+	artifact *registry.Artifact,
+	labels *component.LabelSet,
+) ([]byte, error) {
+	services, _, err := p.resolveServices(ctx, src, labels)
+	if err != nil {
+		return nil, err
+	}
+
+	sourceURL, err := artifactURL(ctx, artifact.Source, p.clientOptions...)
+	if err != nil {
+		return nil, err
+	}
+
+	var metadata map[string]string
+	if p.metadataEnvVars() {
+		metadata = metadataEnvVars(ctx, src, job, dc, artifact.Source)
+	}
+
+	h := sha256.New()
+
+	for _, sc := range services {
+		gen, err := generation(sourceURL, newVersion(sc, "", metadata))
+		if err != nil {
+			return nil, err
+		}
+
+		h.Write([]byte(sc.Name))
+		h.Write([]byte{0})
+		h.Write([]byte(gen))
+		h.Write([]byte{0})
+	}
+
+	return h.Sum(nil), nil
+}
+
+// artifactURL returns the URL of the artifact object at its generation, like
+// versionSource.url.
+func artifactURL(ctx context.Context, sourceURL string, opts ...option.ClientOption) (string, error) {
+	bucket, object, err := appengineutil.ParseObjectURL(sourceURL)
+	if err != nil {
+		return "", err
+	}
+
+	storageService, err := storage.NewService(ctx, opts...)
+	if err != nil {
+		return "", err
+	}
+
+	obj, err := storageService.Objects.Get(bucket, object).Context(ctx).Do()
+	if err != nil {
+		return "", appengineutil.APIError(err)
+	}
+
+	source := &versionSource{
+		zipInfo:          &appengine.ZipInfo{SourceUrl: appengineutil.ObjectURL(bucket, object)},
+		objectGeneration: obj.Generation,
+	}
+
+	return source.url(), nil
+}
+
+// generation hashes the artifact source URL, including the generation of
+// the object, and the version spec. Two deployments with the same generation
+// would create identical versions.
+func generation(sourceURL string, aev *appengine.Version) (string, error) {
+	v := *aev
+	// The version id is generated for each deployment and the deployment
+	// is derived from the source URL.
+	v.Id = ""
+	v.Deployment = nil
+
+	env := make(map[string]string, len(v.EnvVariables))
+	for k, val := range v.EnvVariables {
+		if k != generationEnvVar {
+			env[k] = val
+		}
+	}
+
+	v.EnvVariables = env
+
+	spec, err := json.Marshal(&v)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(sourceURL))
+	h.Write([]byte{0})
+	h.Write(spec)
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// findGeneration returns the version of the service with the given
+// generation, or nil if there is none.
+func findGeneration(
+	ctx context.Context,
+	client appengineutil.Client,
+	project string,
+	service string,
+	gen string,
+) (*appengine.Version, error) {
+	versions, err := client.ListVersions(ctx, project, service, "FULL")
+	if err != nil {
+		// The service does not exist before its first deployment.
+		if errors.Is(err, appengineutil.ErrNotFound) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	for _, v := range versions {
+		if v.EnvVariables[generationEnvVar] == gen {
+			return v, nil
+		}
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,185 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/component"
+	"github.com/sharkyze/waypoint-plugin-cloudstorage/registry"
+	"google.golang.org/api/appengine/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appenginetest"
+)
+
+func Test_generation(t *testing.T) {
+	const sourceURL = "https://storage.googleapis.com/bucket/webapp.zip#1603281600000000"
+
+	base := func() *appengine.Version {
+		return &appengine.Version{
+			Id:            "20201021t120000",
+			Runtime:       "go114",
+			InstanceClass: "F1",
+			EnvVariables:  map[string]string{"PORT": "8080"},
+			Deployment: &appengine.Deployment{
+				Zip: &appengine.ZipInfo{SourceUrl: "https://storage.googleapis.com/bucket/webapp.zip"},
+			},
+		}
+	}
+
+	want, err := generation(sourceURL, base())
+	if err != nil {
+		t.Fatalf("generation() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		sourceURL string
+		modify    func(v *appengine.Version)
+		wantSame  bool
+	}{
+		{
+			name:      "different version id",
+			sourceURL: sourceURL,
+			modify:    func(v *appengine.Version) { v.Id = "20201022t120000" },
+			wantSame:  true,
+		},
+		{
+			name:      "generation env variable",
+			sourceURL: sourceURL,
+			modify:    func(v *appengine.Version) { v.EnvVariables[generationEnvVar] = want },
+			wantSame:  true,
+		},
+		{
+			name:      "different artifact",
+			sourceURL: "https://storage.googleapis.com/bucket/webapp-v2.zip",
+			modify:    func(v *appengine.Version) {},
+			wantSame:  false,
+		},
+		{
+			name:      "overwritten artifact",
+			sourceURL: "https://storage.googleapis.com/bucket/webapp.zip#1603368000000000",
+			modify:    func(v *appengine.Version) {},
+			wantSame:  false,
+		},
+		{
+			name:      "different instance class",
+			sourceURL: sourceURL,
+			modify:    func(v *appengine.Version) { v.InstanceClass = "F2" },
+			wantSame:  false,
+		},
+		{
+			name:      "different env variables",
+			sourceURL: sourceURL,
+			modify:    func(v *appengine.Version) { v.EnvVariables["PORT"] = "8081" },
+			wantSame:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := base()
+			tt.modify(v)
+
+			got, err := generation(tt.sourceURL, v)
+			if err != nil {
+				t.Fatalf("generation() error = %v", err)
+			}
+
+			if (got == want) != tt.wantSame {
+				t.Errorf("generation() = %v, base generation %v, wantSame %v", got, want, tt.wantSame)
+			}
+		})
+	}
+}
+
+func TestPlatform_deploymentGeneration(t *testing.T) {
+	generationOf := func(t *testing.T, fake *appenginetest.Server, config DeployConfig, deploymentID string) []byte {
+		t.Helper()
+
+		ctx := context.Background()
+		p := &Platform{config: config, clientOptions: fake.ClientOptions()}
+		src := &component.Source{App: "webapp", Path: t.TempDir()}
+		dc := &component.DeploymentConfig{Id: deploymentID}
+
+		gen, err := p.deploymentGeneration(ctx, src, nil, dc, &registry.Artifact{Source: testArtifact}, nil)
+		if err != nil {
+			t.Fatalf("deploymentGeneration() error = %v", err)
+		}
+
+		return gen
+	}
+
+	reuse := func(c *DeployConfig) { c.ReuseVersions = true }
+
+	tests := []struct {
+		name         string
+		config       func(c *DeployConfig)
+		setup        func(fake *appenginetest.Server)
+		deploymentID string
+		wantSame     bool
+	}{
+		{
+			name:         "another deployment reusing the versions",
+			config:       reuse,
+			deploymentID: "d2",
+			wantSame:     true,
+		},
+		{
+			name:         "same deployment with the metadata",
+			deploymentID: "d1",
+			wantSame:     false,
+		},
+		{
+			name: "different instance class",
+			config: func(c *DeployConfig) {
+				reuse(c)
+				c.InstanceClass = "F2"
+			},
+			deploymentID: "d1",
+			wantSame:     false,
+		},
+		{
+			name: "another service",
+			config: func(c *DeployConfig) {
+				reuse(c)
+				c.Services = []serviceConfig{{Name: "api"}, {Name: "worker"}}
+			},
+			deploymentID: "d1",
+			wantSame:     false,
+		},
+		{
+			name:   "overwritten artifact",
+			config: reuse,
+			setup: func(fake *appenginetest.Server) {
+				data, _ := fake.Object("artifacts", "webapp.zip")
+				fake.AddObject("artifacts", "webapp.zip", data)
+			},
+			deploymentID: "d1",
+			wantSame:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newTestServer(t)
+
+			base := testConfig()
+			reuse(&base)
+			want := generationOf(t, fake, base, "d1")
+
+			if tt.setup != nil {
+				tt.setup(fake)
+			}
+
+			config := testConfig()
+			if tt.config != nil {
+				tt.config(&config)
+			}
+
+			got := generationOf(t, fake, config, tt.deploymentID)
+			if bytes.Equal(got, want) != tt.wantSame {
+				t.Errorf("deploymentGeneration() = %x, base generation %x, wantSame %v", got, want, tt.wantSame)
+			}
+		})
+	}
+}
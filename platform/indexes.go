@@ -0,0 +1,155 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/datastore/v1"
+	"google.golang.org/api/option"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+type index struct {
+	// Kind: Entity kind the index applies to.
+	Kind string `hcl:"kind"`
+
+	// Ancestor: Whether the index includes the ancestors of the entities.
+	Ancestor bool `hcl:"ancestor,optional"`
+
+	// Properties: Ordered properties of the index.
+	Properties []indexProperty `hcl:"property,block"`
+}
+
+type indexProperty struct {
+	// Name: Name of the property.
+	Name string `hcl:"name"`
+
+	// Direction: Either "asc" or "desc". Defaults to "asc".
+	Direction string `hcl:"direction,optional"`
+}
+
+type indexes []index
+
+// validate checks the indexes configuration.
+func (ix indexes) validate() error {
+	for _, i := range ix {
+		if i.Kind == "" || len(i.Properties) == 0 {
+			return errors.New("Index kind and properties should not be empty")
+		}
+
+		for _, p := range i.Properties {
+			switch strings.ToLower(p.Direction) {
+			case "", "asc", "desc":
+			default:
+				return errors.New(`Index property direction should be either "asc" or "desc"`)
+			}
+		}
+	}
+
+	return nil
+}
+
+// toDatastore converts data to the format expected by the datastore client.
+func (i index) toDatastore() *datastore.GoogleDatastoreAdminV1Index {
+	ancestor := "NONE"
+	if i.Ancestor {
+		ancestor = "ALL_ANCESTORS"
+	}
+
+	props := make([]*datastore.GoogleDatastoreAdminV1IndexedProperty, len(i.Properties))
+	for j, p := range i.Properties {
+		direction := "ASCENDING"
+		if strings.ToLower(p.Direction) == "desc" {
+			direction = "DESCENDING"
+		}
+
+		props[j] = &datastore.GoogleDatastoreAdminV1IndexedProperty{Name: p.Name, Direction: direction}
+	}
+
+	return &datastore.GoogleDatastoreAdminV1Index{Kind: i.Kind, Ancestor: ancestor, Properties: props}
+}
+
+// deployIndexes applies the configured indexes as their own status step.
+func (p *Platform) deployIndexes(ctx context.Context, st terminal.Status, project string) error {
+	if len(p.config.Indexes) == 0 {
+		return nil
+	}
+
+	st.Update("Applying Datastore indexes")
+
+	created, err := applyIndexes(ctx, project, p.config.Indexes, p.clientOptions...)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error applying Datastore indexes")
+		return err
+	}
+
+	st.Step(terminal.StatusOK, "Datastore indexes applied ("+strconv.Itoa(created)+" created, building in the background)")
+
+	return nil
+}
+
+// applyIndexes creates the indexes which do not exist yet. Building the
+// indexes is not waited for and indexes which are not configured anymore
+// are left untouched.
+func applyIndexes(ctx context.Context, project string, ix indexes, opts ...option.ClientOption) (created int, err error) {
+	datastoreService, err := datastore.NewService(ctx, opts...)
+	if err != nil {
+		return 0, err
+	}
+
+	var existing []*datastore.GoogleDatastoreAdminV1Index
+
+	listCall := datastoreService.Projects.Indexes.List(project)
+	err = listCall.Pages(ctx, func(resp *datastore.GoogleDatastoreAdminV1ListIndexesResponse) error {
+		existing = append(existing, resp.Indexes...)
+		return nil
+	})
+	if err != nil {
+		return 0, appengineutil.APIError(err)
+	}
+
+	for _, i := range ix {
+		want := i.toDatastore()
+
+		if containsIndex(existing, want) {
+			continue
+		}
+
+		if _, err := datastoreService.Projects.Indexes.Create(project, want).Context(ctx).Do(); err != nil {
+			return created, appengineutil.APIError(err)
+		}
+
+		created++
+	}
+
+	return created, nil
+}
+
+// containsIndex reports whether an index with the same kind, ancestor and
+// properties exists.
+func containsIndex(existing []*datastore.GoogleDatastoreAdminV1Index, want *datastore.GoogleDatastoreAdminV1Index) bool {
+	for _, e := range existing {
+		if e.Kind != want.Kind || e.Ancestor != want.Ancestor || len(e.Properties) != len(want.Properties) {
+			continue
+		}
+
+		same := true
+
+		for j, p := range e.Properties {
+			if p.Name != want.Properties[j].Name || p.Direction != want.Properties[j].Direction {
+				same = false
+				break
+			}
+		}
+
+		if same {
+			return true
+		}
+	}
+
+	return false
+}
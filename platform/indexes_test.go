@@ -0,0 +1,64 @@
+package platform
+
+import (
+	"testing"
+
+	"google.golang.org/api/datastore/v1"
+)
+
+func Test_containsIndex(t *testing.T) {
+	existing := []*datastore.GoogleDatastoreAdminV1Index{
+		{
+			Kind:     "Task",
+			Ancestor: "NONE",
+			Properties: []*datastore.GoogleDatastoreAdminV1IndexedProperty{
+				{Name: "done", Direction: "ASCENDING"},
+				{Name: "created", Direction: "DESCENDING"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name  string
+		index index
+		want  bool
+	}{
+		{
+			name: "existing",
+			index: index{Kind: "Task", Properties: []indexProperty{
+				{Name: "done"},
+				{Name: "created", Direction: "desc"},
+			}},
+			want: true,
+		},
+		{
+			name: "different direction",
+			index: index{Kind: "Task", Properties: []indexProperty{
+				{Name: "done"},
+				{Name: "created"},
+			}},
+			want: false,
+		},
+		{
+			name: "ancestor",
+			index: index{Kind: "Task", Ancestor: true, Properties: []indexProperty{
+				{Name: "done"},
+				{Name: "created", Direction: "desc"},
+			}},
+			want: false,
+		},
+		{
+			name:  "different kind",
+			index: index{Kind: "User", Properties: []indexProperty{{Name: "email"}}},
+			want:  false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containsIndex(existing, tt.index.toDatastore()); got != tt.want {
+				t.Errorf("containsIndex() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
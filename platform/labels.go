@@ -0,0 +1,77 @@
+package platform
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/component"
+)
+
+// labelEnvVarPrefix prefixes the env variables the Waypoint labels are
+// stored in. App Engine versions have no labels, their env variables are
+// kept as is and returned when listing the versions.
+const labelEnvVarPrefix = "WAYPOINT_LABEL_"
+
+// labelEnvVars returns the env variables storing the labels. The label
+// "waypoint/workspace" is stored in WAYPOINT_LABEL_WAYPOINT_WORKSPACE. Two
+// labels stored in the same env variable, such as "team.name" and
+// "team/name", are an error rather than one of them being dropped.
+func labelEnvVars(labels *component.LabelSet) (map[string]string, error) {
+	if labels == nil {
+		return nil, nil
+	}
+
+	// The keys are sorted for the error to be the same on every deploy.
+	keys := make([]string, 0, len(labels.Labels))
+	for k := range labels.Labels {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	env := make(map[string]string, len(keys))
+	stored := make(map[string]string, len(keys))
+
+	for _, k := range keys {
+		name := labelEnvVarPrefix + labelEnvVarName(k)
+		if other, ok := stored[name]; ok {
+			return nil, fmt.Errorf("labels %q and %q are both stored in the env variable %s", other, k, name)
+		}
+
+		stored[name] = k
+		env[name] = labels.Labels[k]
+	}
+
+	return env, nil
+}
+
+// labelEnvVarName converts the label key to a valid env variable name:
+// upper case letters, digits and underscores.
+func labelEnvVarName(key string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z':
+			return r - 'a' + 'A'
+		case r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		default:
+			return '_'
+		}
+	}, key)
+}
+
+// withEnvVars returns the env variables of the service added to env. The
+// env variables of the service take precedence.
+func withEnvVars(env, service map[string]string) map[string]string {
+	merged := make(map[string]string, len(env)+len(service))
+	for k, v := range env {
+		merged[k] = v
+	}
+
+	for k, v := range service {
+		merged[k] = v
+	}
+
+	return merged
+}
@@ -0,0 +1,54 @@
+package platform
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/component"
+)
+
+func Test_labelEnvVars(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  *component.LabelSet
+		want    map[string]string
+		wantErr bool
+	}{
+		{
+			name: "no labels",
+		},
+		{
+			name: "labels",
+			labels: &component.LabelSet{Labels: map[string]string{
+				"waypoint/workspace": "default",
+				"git.commit":         "3c5f1a2",
+				"team":               "payments",
+			}},
+			want: map[string]string{
+				"WAYPOINT_LABEL_WAYPOINT_WORKSPACE": "default",
+				"WAYPOINT_LABEL_GIT_COMMIT":         "3c5f1a2",
+				"WAYPOINT_LABEL_TEAM":               "payments",
+			},
+		},
+		{
+			name: "labels stored in the same env variable",
+			labels: &component.LabelSet{Labels: map[string]string{
+				"team.name": "payments",
+				"team/name": "billing",
+			}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := labelEnvVars(tt.labels)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("labelEnvVars() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("labelEnvVars() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,67 @@
+package platform
+
+import (
+	"context"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/component"
+)
+
+// The env variables exposing the deployment metadata to the running app.
+const (
+	deploymentIDEnvVar   = "WAYPOINT_DEPLOYMENT_ID"
+	appEnvVar            = "WAYPOINT_APP"
+	workspaceEnvVar      = "WAYPOINT_WORKSPACE"
+	gitCommitEnvVar      = "GIT_COMMIT"
+	artifactSourceEnvVar = "WAYPOINT_ARTIFACT_SOURCE"
+)
+
+// metadataEnvVars returns the env variables describing the deployment.
+// Values which are not known are left out, for example the git commit when
+// the app is not in a git repository.
+func metadataEnvVars(
+	ctx context.Context,
+	src *component.Source,
+	job *component.JobInfo,
+	dc *component.DeploymentConfig,
+	artifactSource string,
+) map[string]string {
+	env := map[string]string{
+		appEnvVar:            src.App,
+		artifactSourceEnvVar: artifactSource,
+	}
+
+	if dc != nil {
+		env[deploymentIDEnvVar] = dc.Id
+	}
+
+	if job != nil {
+		env[workspaceEnvVar] = job.Workspace
+	}
+
+	if commit, err := gitCommit(ctx, src.Path); err == nil {
+		env[gitCommitEnvVar] = commit
+	}
+
+	for k, v := range env {
+		if v == "" {
+			delete(env, k)
+		}
+	}
+
+	return env
+}
+
+// gitCommit returns the commit checked out in the git repository at path.
+func gitCommit(ctx context.Context, path string) (string, error) {
+	return git(ctx, path, "rev-parse", "HEAD")
+}
+
+// setMissingEnvVars adds the env variables to the version, except the ones
+// it already has.
+func setMissingEnvVars(versionEnv, env map[string]string) {
+	for k, v := range env {
+		if _, ok := versionEnv[k]; !ok {
+			versionEnv[k] = v
+		}
+	}
+}
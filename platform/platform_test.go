@@ -0,0 +1,797 @@
+package platform
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/component"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"github.com/sharkyze/waypoint-plugin-cloudstorage/registry"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appenginetest"
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+const (
+	testProject  = "project"
+	testService  = "api"
+	testArtifact = "gs://artifacts/webapp.zip"
+)
+
+// newTestServer starts a fake App Engine server whose operations finish
+// after several polls, with the artifact uploaded.
+func newTestServer(t *testing.T) *appenginetest.Server {
+	t.Helper()
+
+	pollInterval := appengineutil.PollInterval
+	appengineutil.PollInterval = time.Millisecond
+
+	fake := appenginetest.NewServer()
+	fake.OperationPolls = 3
+
+	var buf bytes.Buffer
+
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"main.go", "go.mod"} {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _ = f.Write([]byte("package main\n"))
+	}
+
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.AddObject("artifacts", "webapp.zip", buf.Bytes())
+
+	t.Cleanup(func() {
+		fake.Close()
+		appengineutil.PollInterval = pollInterval
+	})
+
+	return fake
+}
+
+func testConfig() DeployConfig {
+	return DeployConfig{
+		Project:       testProject,
+		Service:       testService,
+		Runtime:       "go114",
+		InstanceClass: "F1",
+		EnvVars:       map[string]string{"PORT": "8080"},
+	}
+}
+
+func TestPlatform_deploy(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       func(c *DeployConfig)
+		setup        func(fake *appenginetest.Server)
+		artifact     string
+		wantErr      string
+		wantVersions int
+		wantServing  bool
+	}{
+		{
+			name:         "new service",
+			wantVersions: 1,
+			wantServing:  true,
+		},
+		{
+			name: "existing service",
+			setup: func(fake *appenginetest.Server) {
+				fake.AddVersion(testProject, testService, &appengine.Version{Id: "v1", Runtime: "go114"})
+			},
+			wantVersions: 2,
+		},
+		{
+			name:     "missing artifact",
+			artifact: "gs://artifacts/missing.zip",
+			wantErr:  "does not exist",
+		},
+		{
+			name: "build failure deletes the version",
+			setup: func(fake *appenginetest.Server) {
+				fake.AddVersion(testProject, testService, &appengine.Version{Id: "v1", Runtime: "go114"})
+				fake.FailBuilds(testProject, testService, "Build failed")
+			},
+			wantErr:      "was deleted",
+			wantVersions: 1,
+		},
+		{
+			name:         "dry run",
+			config:       func(c *DeployConfig) { c.DryRun = true },
+			wantErr:      "dry run",
+			wantVersions: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := newTestServer(t)
+
+			if tt.setup != nil {
+				tt.setup(fake)
+			}
+
+			p := &Platform{config: testConfig(), clientOptions: fake.ClientOptions()}
+			if tt.config != nil {
+				tt.config(&p.config)
+			}
+
+			artifact := tt.artifact
+			if artifact == "" {
+				artifact = testArtifact
+			}
+
+			src := &component.Source{App: "webapp"}
+
+			d, err := p.deploy(ctx, src, nil, nil, &registry.Artifact{Source: artifact}, nil, terminal.NonInteractiveUI(ctx))
+			if (err != nil) != (tt.wantErr != "") || (err != nil && !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("deploy() error = %v, wantErr %q", err, tt.wantErr)
+			}
+
+			if got := len(fake.Versions(testProject, testService)); got != tt.wantVersions {
+				t.Errorf("deploy() versions = %d, want %d", got, tt.wantVersions)
+			}
+
+			if err != nil {
+				return
+			}
+
+			v := fake.Version(testProject, testService, d.VersionId)
+			if v == nil {
+				t.Fatalf("deploy() version %q not created", d.VersionId)
+			}
+
+			if v.InstanceClass != "F1" || v.EnvVariables["PORT"] != "8080" {
+				t.Errorf("deploy() version = %+v", v)
+			}
+
+			split := fake.Service(testProject, testService).Split.Allocations
+			if serving := split[d.VersionId] == 1; serving != tt.wantServing {
+				t.Errorf("deploy() split = %v, want serving %v", split, tt.wantServing)
+			}
+		})
+	}
+}
+
+func TestPlatform_deploy_dryRun(t *testing.T) {
+	ctx := context.Background()
+	fake := newTestServer(t)
+	fake.AddVersion(testProject, testService, &appengine.Version{Id: "v1", Runtime: "go114", InstanceClass: "F2"})
+
+	p := &Platform{config: testConfig(), clientOptions: fake.ClientOptions()}
+	p.config.DryRun = true
+
+	src := &component.Source{App: "webapp"}
+
+	_, err := p.deploy(ctx, src, nil, nil, &registry.Artifact{Source: testArtifact}, nil, terminal.NonInteractiveUI(ctx))
+	if s, ok := status.FromError(err); !ok || s.Code() != codes.Aborted {
+		t.Fatalf("deploy() error = %v, want a %v status", err, codes.Aborted)
+	}
+
+	var comparedWithServing bool
+
+	for _, r := range fake.Requests() {
+		if !strings.HasPrefix(r, "GET ") {
+			t.Errorf("deploy() request %q, want no mutation on a dry run", r)
+		}
+
+		comparedWithServing = comparedWithServing || strings.HasSuffix(r, "/versions/v1")
+	}
+
+	if !comparedWithServing {
+		t.Errorf("deploy() requests = %v, want the serving version fetched to compare with", fake.Requests())
+	}
+}
+
+func TestPlatform_deploy_reuse(t *testing.T) {
+	ctx := context.Background()
+	fake := newTestServer(t)
+
+	config := testConfig()
+	config.ReuseVersions = true
+
+	p := &Platform{config: config, clientOptions: fake.ClientOptions()}
+	src := &component.Source{App: "webapp"}
+	artifact := &registry.Artifact{Source: testArtifact}
+
+	first, err := p.deploy(ctx, src, nil, &component.DeploymentConfig{Id: "d1"}, artifact, nil, terminal.NonInteractiveUI(ctx))
+	if err != nil {
+		t.Fatalf("deploy() error = %v", err)
+	}
+
+	second, err := p.deploy(ctx, src, nil, &component.DeploymentConfig{Id: "d2"}, artifact, nil, terminal.NonInteractiveUI(ctx))
+	if err != nil {
+		t.Fatalf("deploy() error = %v", err)
+	}
+
+	if second.VersionId != first.VersionId {
+		t.Errorf("deploy() version = %q, want the reused version %q", second.VersionId, first.VersionId)
+	}
+
+	var creates int
+
+	for _, r := range fake.Requests() {
+		if strings.HasPrefix(r, "POST /v1/apps/") {
+			creates++
+		}
+	}
+
+	if creates != 1 {
+		t.Errorf("deploy() created %d versions, want 1", creates)
+	}
+
+	// The shared version is only deleted with the last deployment using it,
+	// destroying a deployment twice is not an error.
+	fake.AddVersion(testProject, testService, &appengine.Version{Id: "v0", Runtime: "go114"})
+	splitTo(t, fake, map[string]float64{"v0": 1})
+
+	for _, d := range []*Deployment{first, second, second} {
+		if err := p.destroy(ctx, terminal.NonInteractiveUI(ctx), d); err != nil {
+			t.Fatalf("destroy() of %q error = %v", d.Ref, err)
+		}
+
+		exists := fake.Version(testProject, testService, first.VersionId) != nil
+		if want := d == first; exists != want {
+			t.Errorf("destroy() of %q, version exists = %v, want %v", d.Ref, exists, want)
+		}
+	}
+
+	if refs := fake.Objects("staging."+testProject+".appspot.com", refsPrefix); len(refs) != 0 {
+		t.Errorf("destroy() references = %v, want none", refs)
+	}
+}
+
+func TestPlatform_deploy_notReused(t *testing.T) {
+	ctx := context.Background()
+	fake := newTestServer(t)
+
+	p := &Platform{config: testConfig(), clientOptions: fake.ClientOptions()}
+	src := &component.Source{App: "webapp", Path: t.TempDir()}
+	artifact := &registry.Artifact{Source: testArtifact}
+
+	first, err := p.deploy(ctx, src, nil, &component.DeploymentConfig{Id: "d1"}, artifact, nil, terminal.NonInteractiveUI(ctx))
+	if err != nil {
+		t.Fatalf("deploy() error = %v", err)
+	}
+
+	// The version ids have a one second resolution, the version of the
+	// first deployment is moved aside for the next one to be created.
+	old := *fake.Version(testProject, testService, first.VersionId)
+	old.Id = "old"
+	fake.AddVersion(testProject, testService, &old)
+
+	fake.AddVersion(testProject, testService, &appengine.Version{Id: "v0", Runtime: "go114"})
+	splitTo(t, fake, map[string]float64{"v0": 1})
+
+	if err := p.destroy(ctx, terminal.NonInteractiveUI(ctx), first); err != nil {
+		t.Fatalf("destroy() error = %v", err)
+	}
+
+	// Without ReuseVersions, an identical deployment creates a new version
+	// exposing its own metadata.
+	second, err := p.deploy(ctx, src, nil, &component.DeploymentConfig{Id: "d2"}, artifact, nil, terminal.NonInteractiveUI(ctx))
+	if err != nil {
+		t.Fatalf("deploy() error = %v", err)
+	}
+
+	if second.VersionId == "old" {
+		t.Fatalf("deploy() version = %q, want a new version", second.VersionId)
+	}
+
+	env := fake.Version(testProject, testService, second.VersionId).EnvVariables
+	if got := env[deploymentIDEnvVar]; got != "d2" {
+		t.Errorf("deploy() %s = %q, want %q", deploymentIDEnvVar, got, "d2")
+	}
+}
+
+func TestPlatform_deploy_metadata(t *testing.T) {
+	disabled := false
+
+	tests := []struct {
+		name    string
+		config  func(c *DeployConfig)
+		wantEnv map[string]string
+	}{
+		{
+			name: "injected",
+			wantEnv: map[string]string{
+				"PORT":                     "8080",
+				"WAYPOINT_DEPLOYMENT_ID":   "01EN3K3Y3X",
+				"WAYPOINT_APP":             "webapp",
+				"WAYPOINT_WORKSPACE":       "staging",
+				"WAYPOINT_ARTIFACT_SOURCE": testArtifact,
+			},
+		},
+		{
+			name:   "configured env variables take precedence",
+			config: func(c *DeployConfig) { c.EnvVars["WAYPOINT_APP"] = "api" },
+			wantEnv: map[string]string{
+				"PORT":                     "8080",
+				"WAYPOINT_DEPLOYMENT_ID":   "01EN3K3Y3X",
+				"WAYPOINT_APP":             "api",
+				"WAYPOINT_WORKSPACE":       "staging",
+				"WAYPOINT_ARTIFACT_SOURCE": testArtifact,
+			},
+		},
+		{
+			name:    "disabled",
+			config:  func(c *DeployConfig) { c.MetadataEnvVars = &disabled },
+			wantEnv: map[string]string{"PORT": "8080"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := newTestServer(t)
+
+			p := &Platform{config: testConfig(), clientOptions: fake.ClientOptions()}
+			if tt.config != nil {
+				tt.config(&p.config)
+			}
+
+			// The source is not in a git repository, the commit is unknown.
+			src := &component.Source{App: "webapp", Path: t.TempDir()}
+			job := &component.JobInfo{Workspace: "staging"}
+			dc := &component.DeploymentConfig{Id: "01EN3K3Y3X"}
+
+			d, err := p.deploy(ctx, src, job, dc, &registry.Artifact{Source: testArtifact}, nil, terminal.NonInteractiveUI(ctx))
+			if err != nil {
+				t.Fatalf("deploy() error = %v", err)
+			}
+
+			env := fake.Version(testProject, testService, d.VersionId).EnvVariables
+			delete(env, generationEnvVar)
+
+			if !reflect.DeepEqual(env, tt.wantEnv) {
+				t.Errorf("deploy() env variables = %v, want %v", env, tt.wantEnv)
+			}
+		})
+	}
+}
+
+func TestPlatform_deploy_labels(t *testing.T) {
+	disabled := false
+
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		config  func(c *DeployConfig)
+		wantEnv map[string]string
+		wantErr bool
+	}{
+		{
+			name:   "stored",
+			labels: map[string]string{"waypoint/workspace": "staging", "team": "payments"},
+			wantEnv: map[string]string{
+				"PORT":                              "8080",
+				"WAYPOINT_LABEL_WAYPOINT_WORKSPACE": "staging",
+				"WAYPOINT_LABEL_TEAM":               "payments",
+			},
+		},
+		{
+			name:   "configured env variables take precedence",
+			labels: map[string]string{"team": "payments"},
+			config: func(c *DeployConfig) { c.EnvVars["WAYPOINT_LABEL_TEAM"] = "billing" },
+			wantEnv: map[string]string{
+				"PORT":                "8080",
+				"WAYPOINT_LABEL_TEAM": "billing",
+			},
+		},
+		{
+			name:    "labels stored in the same env variable",
+			labels:  map[string]string{"team.name": "payments", "team/name": "billing"},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := newTestServer(t)
+
+			config := testConfig()
+			config.MetadataEnvVars = &disabled
+
+			if tt.config != nil {
+				tt.config(&config)
+			}
+
+			p := &Platform{config: config, clientOptions: fake.ClientOptions()}
+			src := &component.Source{App: "webapp"}
+			labels := &component.LabelSet{Labels: tt.labels}
+
+			d, err := p.deploy(ctx, src, nil, nil, &registry.Artifact{Source: testArtifact}, labels, terminal.NonInteractiveUI(ctx))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("deploy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr {
+				if versions := fake.Versions(testProject, testService); len(versions) != 0 {
+					t.Errorf("deploy() versions = %v, want none", versions)
+				}
+
+				return
+			}
+
+			env := fake.Version(testProject, testService, d.VersionId).EnvVariables
+			delete(env, generationEnvVar)
+
+			if !reflect.DeepEqual(env, tt.wantEnv) {
+				t.Errorf("deploy() env variables = %v, want %v", env, tt.wantEnv)
+			}
+		})
+	}
+}
+
+func TestPlatform_destroy(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       DeployConfig
+		versions     []string
+		split        map[string]float64
+		wantErr      bool
+		wantVersions []string
+		wantSplit    map[string]float64
+		wantNoSvc    bool
+	}{
+		{
+			name:         "version without traffic",
+			versions:     []string{"v1", "v2"},
+			split:        map[string]float64{"v1": 1},
+			wantVersions: []string{"v1"},
+			wantSplit:    map[string]float64{"v1": 1},
+		},
+		{
+			name:         "version with traffic",
+			versions:     []string{"v1", "v2"},
+			split:        map[string]float64{"v2": 1},
+			wantErr:      true,
+			wantVersions: []string{"v1", "v2"},
+			wantSplit:    map[string]float64{"v2": 1},
+		},
+		{
+			name:         "version with traffic and fallback",
+			config:       DeployConfig{DestroyPolicy: destroyPolicyFallback, DestroyFallbackVersion: "v1"},
+			versions:     []string{"v1", "v2"},
+			split:        map[string]float64{"v2": 1},
+			wantVersions: []string{"v1"},
+			wantSplit:    map[string]float64{"v1": 1},
+		},
+		{
+			name: "fallback of the service block",
+			config: DeployConfig{
+				DestroyPolicy:          destroyPolicyFallback,
+				DestroyFallbackVersion: "v0",
+				Services:               []serviceConfig{{Name: testService, DestroyFallbackVersion: "v1"}},
+			},
+			versions:     []string{"v1", "v2"},
+			split:        map[string]float64{"v2": 1},
+			wantVersions: []string{"v1"},
+			wantSplit:    map[string]float64{"v1": 1},
+		},
+		{
+			name:         "missing fallback version",
+			config:       DeployConfig{DestroyPolicy: destroyPolicyFallback, DestroyFallbackVersion: "v0"},
+			versions:     []string{"v1", "v2"},
+			split:        map[string]float64{"v2": 1},
+			wantErr:      true,
+			wantVersions: []string{"v1", "v2"},
+			wantSplit:    map[string]float64{"v2": 1},
+		},
+		{
+			name:      "last version of the service",
+			config:    DeployConfig{DeleteServiceWhenEmpty: true},
+			versions:  []string{"v2"},
+			split:     map[string]float64{"v2": 1},
+			wantNoSvc: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := newTestServer(t)
+
+			for _, id := range tt.versions {
+				fake.AddVersion(testProject, testService, &appengine.Version{Id: id, Runtime: "go114"})
+			}
+
+			splitTo(t, fake, tt.split)
+
+			p := &Platform{config: tt.config, clientOptions: fake.ClientOptions()}
+			d := &Deployment{
+				Project:   testProject,
+				Service:   testService,
+				VersionId: "v2",
+				Versions:  []*Deployment_Version{{Service: testService, VersionId: "v2", ConfigService: testService}},
+			}
+
+			err := p.destroy(ctx, terminal.NonInteractiveUI(ctx), d)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("destroy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if tt.wantNoSvc {
+				if aes := fake.Service(testProject, testService); aes != nil {
+					t.Errorf("destroy() service = %+v, want deleted", aes)
+				}
+
+				return
+			}
+
+			versions := fake.Versions(testProject, testService)
+			if !reflect.DeepEqual(versions, tt.wantVersions) {
+				t.Errorf("destroy() versions = %v, want %v", versions, tt.wantVersions)
+			}
+
+			if got := fake.Service(testProject, testService).Split.Allocations; !reflect.DeepEqual(got, tt.wantSplit) {
+				t.Errorf("destroy() split = %v, want %v", got, tt.wantSplit)
+			}
+		})
+	}
+}
+
+// splitTo sets the traffic split of the test service through the API.
+func splitTo(t *testing.T, fake *appenginetest.Server, allocations map[string]float64) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	client, err := appengineutil.NewClient(ctx, fake.ClientOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	op, err := client.PatchService(ctx, testProject, testService, &appengine.Service{
+		Split: &appengine.TrafficSplit{Allocations: allocations},
+	}, "split")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := appengineutil.WaitForOperation(ctx, client, op); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlatform_deployService_status(t *testing.T) {
+	disabled := false
+
+	tests := []struct {
+		name     string
+		config   func(c *DeployConfig)
+		wantNote string
+	}{
+		{
+			name:     "failed version deleted",
+			wantNote: "was deleted",
+		},
+		{
+			name:     "failed version kept",
+			config:   func(c *DeployConfig) { c.CleanupOnFailure = &disabled },
+			wantNote: "was not deleted",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := newTestServer(t)
+			fake.AddVersion(testProject, testService, &appengine.Version{Id: "v1", Runtime: "go114"})
+			fake.FailBuilds(testProject, testService, "Build failed")
+
+			p := &Platform{config: testConfig(), clientOptions: fake.ClientOptions()}
+			if tt.config != nil {
+				tt.config(&p.config)
+			}
+
+			client, err := p.appengineClient(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			source := &versionSource{zipInfo: &appengine.ZipInfo{SourceUrl: appengineutil.ObjectURL("artifacts", "webapp.zip")}}
+
+			refs, err := p.deploymentRefs(ctx, client, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, _, err = p.deployService(ctx, terminal.NonInteractiveUI(ctx), client, p.config.serviceConfigs()[0], source, refs, nil)
+
+			// Waypoint renders the gRPC status of the error, status.FromError
+			// does not unwrap errors.
+			s, ok := status.FromError(err)
+			if !ok || s.Code() != codes.FailedPrecondition {
+				t.Fatalf("deployService() error = %v, want a %v status", err, codes.FailedPrecondition)
+			}
+
+			if !errors.Is(err, appengineutil.ErrBuildFailed) || !strings.Contains(s.Message(), tt.wantNote) {
+				t.Errorf("deployService() error = %v, want a build failure which %s", err, tt.wantNote)
+			}
+		})
+	}
+}
+
+func TestPlatform_deploy_services(t *testing.T) {
+	tests := []struct {
+		name         string
+		config       func(c *DeployConfig)
+		setup        func(fake *appenginetest.Server)
+		wantErr      bool
+		wantVersions map[string]int
+	}{
+		{
+			name:         "all services deployed",
+			wantVersions: map[string]int{"api": 1, "worker": 1},
+		},
+		{
+			name: "files source mode",
+			config: func(c *DeployConfig) {
+				c.SourceMode = sourceModeFiles
+				c.StagingBucket = "staging"
+			},
+			wantVersions: map[string]int{"api": 1, "worker": 1},
+		},
+		{
+			name: "failed service deletes the other versions",
+			setup: func(fake *appenginetest.Server) {
+				fake.AddVersion(testProject, "api", &appengine.Version{Id: "v1", Runtime: "go114"})
+				fake.AddVersion(testProject, "worker", &appengine.Version{Id: "v1", Runtime: "go114"})
+				fake.FailBuilds(testProject, "worker", "Build failed")
+			},
+			wantErr:      true,
+			wantVersions: map[string]int{"api": 1, "worker": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := newTestServer(t)
+
+			if tt.setup != nil {
+				tt.setup(fake)
+			}
+
+			config := testConfig()
+			config.Service = ""
+			config.Parallelism = 1
+			config.Services = []serviceConfig{
+				{Name: "api", Runtime: "go115"},
+				{Name: "worker", EnvVars: map[string]string{"QUEUE": "emails"}},
+			}
+
+			if tt.config != nil {
+				tt.config(&config)
+			}
+
+			p := &Platform{config: config, clientOptions: fake.ClientOptions()}
+			src := &component.Source{App: "webapp"}
+
+			d, err := p.deploy(ctx, src, nil, nil, &registry.Artifact{Source: testArtifact}, nil, terminal.NonInteractiveUI(ctx))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("deploy() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil && status.Code(err) != codes.FailedPrecondition {
+				t.Errorf("deploy() error = %v, want a %v status", err, codes.FailedPrecondition)
+			}
+
+			for service, want := range tt.wantVersions {
+				if got := len(fake.Versions(testProject, service)); got != want {
+					t.Errorf("deploy() versions of %q = %d, want %d", service, got, want)
+				}
+			}
+
+			if err != nil {
+				if refs := fake.Objects("staging."+testProject+".appspot.com", refsPrefix); len(refs) != 0 {
+					t.Errorf("deploy() references = %v, want none after a failure", refs)
+				}
+
+				return
+			}
+
+			if len(d.Versions) != 2 || d.Versions[0].Service != "api" || d.Versions[1].Service != "worker" {
+				t.Fatalf("deploy() versions = %v", d.Versions)
+			}
+
+			for _, v := range d.Versions {
+				if v.ConfigService != v.Service {
+					t.Errorf("deploy() version %v, want its configured service recorded", v)
+				}
+			}
+
+			api := fake.Version(testProject, "api", d.Versions[0].VersionId)
+			worker := fake.Version(testProject, "worker", d.Versions[1].VersionId)
+
+			if api.Runtime != "go115" || worker.Runtime != "go114" {
+				t.Errorf("deploy() runtimes = %q, %q", api.Runtime, worker.Runtime)
+			}
+
+			if worker.EnvVariables["QUEUE"] != "emails" || worker.EnvVariables["PORT"] != "8080" {
+				t.Errorf("deploy() worker env = %v", worker.EnvVariables)
+			}
+
+			if config.SourceMode == sourceModeFiles {
+				for _, v := range []*appengine.Version{api, worker} {
+					if v.Deployment == nil || len(v.Deployment.Files) != 2 || v.Deployment.Zip != nil {
+						t.Errorf("deploy() deployment of %q = %+v, want a files manifest", v.Name, v.Deployment)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestPlatform_deployServices_canceled(t *testing.T) {
+	fake := newTestServer(t)
+
+	config := testConfig()
+	config.Service = ""
+	config.Parallelism = 1
+	config.Services = []serviceConfig{{Name: "api"}, {Name: "worker"}}
+
+	p := &Platform{config: config, clientOptions: fake.ClientOptions()}
+
+	client, err := p.appengineClient(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	refs, err := p.deploymentRefs(context.Background(), client, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	source := &versionSource{zipInfo: &appengine.ZipInfo{SourceUrl: appengineutil.ObjectURL("artifacts", "webapp.zip")}}
+
+	_, err = p.deployServices(ctx, terminal.NonInteractiveUI(ctx), client, p.config.serviceConfigs(), source, refs, nil)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("deployServices() error = %v, want %v", err, context.Canceled)
+	}
+
+	for _, service := range []string{"api", "worker"} {
+		if got := fake.Versions(testProject, service); len(got) != 0 {
+			t.Errorf("deployServices() versions of %q = %v, want none", service, got)
+		}
+	}
+}
+
+func TestPlatform_deploy_resolvedServiceCollision(t *testing.T) {
+	ctx := context.Background()
+	fake := newTestServer(t)
+
+	config := testConfig()
+	config.Service = ""
+	config.ServiceTemplate = serviceTemplateService + "-preview"
+	config.Services = []serviceConfig{{Name: "api_v2"}, {Name: "api.v2"}}
+
+	p := &Platform{config: config, clientOptions: fake.ClientOptions()}
+	src := &component.Source{App: "webapp"}
+
+	_, err := p.deploy(ctx, src, nil, nil, &registry.Artifact{Source: testArtifact}, nil, terminal.NonInteractiveUI(ctx))
+	if err == nil || !strings.Contains(err.Error(), `resolve to service "api-v2-preview"`) {
+		t.Fatalf("deploy() error = %v, want the services resolving to the same name", err)
+	}
+
+	for _, r := range fake.Requests() {
+		if strings.HasPrefix(r, "POST ") {
+			t.Errorf("deploy() request %q, want nothing deployed", r)
+		}
+	}
+}
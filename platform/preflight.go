@@ -0,0 +1,206 @@
+package platform
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/cloudresourcemanager/v1"
+	"google.golang.org/api/option"
+	"google.golang.org/api/storage/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+// storageReadRoles are the bucket roles which allow reading objects.
+var storageReadRoles = map[string]bool{
+	"roles/storage.admin":              true,
+	"roles/storage.objectAdmin":        true,
+	"roles/storage.objectViewer":       true,
+	"roles/storage.legacyObjectReader": true,
+	"roles/storage.legacyBucketOwner":  true,
+	"roles/storage.legacyBucketReader": true,
+}
+
+// preflight makes sure the artifact exists in Google Cloud Storage before
+// creating a new version, which otherwise fails minutes later on Cloud Build.
+// It returns the source to deploy from.
+func preflight(
+	ctx context.Context,
+	st terminal.Status,
+	project string,
+	sourceURL string,
+	opts ...option.ClientOption,
+) (*versionSource, error) {
+	st.Update("Checking artifact '" + sourceURL + "'")
+
+	bucket, object, err := appengineutil.ParseObjectURL(sourceURL)
+	if err != nil {
+		st.Step(terminal.StatusError, "Invalid artifact source")
+		return nil, err
+	}
+
+	storageService, err := storage.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	obj, err := storageService.Objects.Get(bucket, object).Context(ctx).Do()
+	if err != nil {
+		err = appengineutil.APIError(err)
+		if errors.Is(err, appengineutil.ErrNotFound) {
+			st.Step(terminal.StatusError, "Artifact not found '"+sourceURL+"'")
+			return nil, appengineutil.Annotate(err, "artifact "+sourceURL+" does not exist")
+		}
+
+		st.Step(terminal.StatusError, "Error fetching the artifact")
+		return nil, err
+	}
+
+	st.Step(terminal.StatusOK, "Artifact found '"+sourceURL+"'")
+
+	readable, err := bucketReadableByAppEngine(ctx, storageService, bucket, project, opts...)
+	switch {
+	case err != nil:
+		st.Step(terminal.StatusWarn, "Could not verify that App Engine can read bucket '"+bucket+"': "+err.Error())
+	case !readable:
+		st.Step(terminal.StatusWarn, "Bucket '"+bucket+"' might not be readable by the App Engine service agent")
+	}
+
+	source := &versionSource{
+		zipInfo:          &appengine.ZipInfo{SourceUrl: appengineutil.ObjectURL(bucket, object)},
+		objectGeneration: obj.Generation,
+	}
+
+	count, err := zipFilesCount(ctx, storageService, obj)
+	if err != nil {
+		st.Step(terminal.StatusWarn, "Could not count the files of the artifact: "+err.Error())
+		return source, nil
+	}
+
+	source.zipInfo.FilesCount = count
+
+	return source, nil
+}
+
+// bucketReadableByAppEngine reports whether the bucket policy grants a read
+// role to the accounts fetching the source of a new version: the App Engine
+// service agent and the Cloud Build service account. Both are named after
+// the project number.
+func bucketReadableByAppEngine(
+	ctx context.Context,
+	storageService *storage.Service,
+	bucket string,
+	project string,
+	opts ...option.ClientOption,
+) (bool, error) {
+	crmService, err := cloudresourcemanager.NewService(ctx, opts...)
+	if err != nil {
+		return false, err
+	}
+
+	p, err := crmService.Projects.Get(project).Context(ctx).Do()
+	if err != nil {
+		return false, fmt.Errorf("fetching the project number: %w", err)
+	}
+
+	number := strconv.FormatInt(p.ProjectNumber, 10)
+
+	policy, err := storageService.Buckets.GetIamPolicy(bucket).Context(ctx).Do()
+	if err != nil {
+		return false, err
+	}
+
+	members := map[string]bool{
+		"allUsers":              true,
+		"allAuthenticatedUsers": true,
+		"serviceAccount:service-" + number + "@gcp-gae-service.iam.gserviceaccount.com": true,
+		"serviceAccount:" + number + "@cloudbuild.gserviceaccount.com":                  true,
+	}
+
+	for _, b := range policy.Bindings {
+		if !storageReadRoles[b.Role] {
+			continue
+		}
+
+		for _, m := range b.Members {
+			if members[m] {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// zipFilesCount counts the files in a zip object. Only the zip central
+// directory is downloaded.
+func zipFilesCount(
+	ctx context.Context,
+	storageService *storage.Service,
+	obj *storage.Object,
+) (int64, error) {
+	r := &objectReaderAt{ctx: ctx, service: storageService, obj: obj}
+
+	zr, err := zip.NewReader(r, int64(obj.Size))
+	if err != nil {
+		return 0, err
+	}
+
+	var count int64
+
+	for _, f := range zr.File {
+		if !f.FileInfo().IsDir() {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// objectReaderAt implements io.ReaderAt on top of ranged object downloads.
+type objectReaderAt struct {
+	ctx     context.Context
+	service *storage.Service
+	obj     *storage.Object
+}
+
+func (r *objectReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	size := int64(r.obj.Size)
+	if off >= size {
+		return 0, io.EOF
+	}
+
+	end := off + int64(len(p))
+	if end > size {
+		end = size
+	}
+
+	getCall := r.service.Objects.Get(r.obj.Bucket, r.obj.Name).Generation(r.obj.Generation)
+	getCall.Header().Set("Range", fmt.Sprintf("bytes=%d-%d", off, end-1))
+
+	resp, err := getCall.Context(r.ctx).Download()
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	n, err := io.ReadFull(resp.Body, p[:end-off])
+	if err != nil {
+		return n, err
+	}
+
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if n < len(p) {
+		return n, io.EOF
+	}
+
+	return n, nil
+}
@@ -0,0 +1,145 @@
+package platform
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/storage/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func Test_preflight(t *testing.T) {
+	tests := []struct {
+		name     string
+		artifact string
+		wantCode codes.Code
+	}{
+		{
+			name:     "artifact found",
+			artifact: testArtifact,
+			wantCode: codes.OK,
+		},
+		{
+			name:     "artifact not found",
+			artifact: "gs://artifacts/missing.zip",
+			wantCode: codes.NotFound,
+		},
+		{
+			name:     "bucket not found",
+			artifact: "gs://missing/webapp.zip",
+			wantCode: codes.NotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := newTestServer(t)
+
+			ui := terminal.NonInteractiveUI(ctx)
+			st := ui.Status()
+			defer st.Close()
+
+			source, err := preflight(ctx, st, testProject, tt.artifact, fake.ClientOptions()...)
+
+			// Waypoint renders the status of the error, it must not be
+			// hidden behind a wrapping error.
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("preflight() error = %v, code %v, want %v", err, got, tt.wantCode)
+			}
+
+			if err != nil {
+				if !strings.Contains(err.Error(), tt.artifact+" does not exist") {
+					t.Errorf("preflight() error = %v, want the artifact named", err)
+				}
+
+				return
+			}
+
+			if source.objectGeneration == 0 {
+				t.Errorf("preflight() object generation = 0, want the generation of the artifact")
+			}
+		})
+	}
+}
+
+func Test_bucketReadableByAppEngine(t *testing.T) {
+	tests := []struct {
+		name    string
+		number  int64
+		role    string
+		member  string
+		want    bool
+		wantErr bool
+	}{
+		{
+			name:   "App Engine service agent",
+			number: 123456789,
+			role:   "roles/storage.objectViewer",
+			member: "serviceAccount:service-123456789@gcp-gae-service.iam.gserviceaccount.com",
+			want:   true,
+		},
+		{
+			name:   "Cloud Build service account",
+			number: 123456789,
+			role:   "roles/storage.legacyBucketReader",
+			member: "serviceAccount:123456789@cloudbuild.gserviceaccount.com",
+			want:   true,
+		},
+		{
+			name:   "public bucket",
+			number: 123456789,
+			role:   "roles/storage.objectViewer",
+			member: "allUsers",
+			want:   true,
+		},
+		{
+			name:   "App Engine default service account",
+			number: 123456789,
+			role:   "roles/storage.objectViewer",
+			member: "serviceAccount:" + testProject + "@appspot.gserviceaccount.com",
+		},
+		{
+			name:   "write only role",
+			number: 123456789,
+			role:   "roles/storage.objectCreator",
+			member: "serviceAccount:service-123456789@gcp-gae-service.iam.gserviceaccount.com",
+		},
+		{
+			name:    "unknown project",
+			role:    "roles/storage.objectViewer",
+			member:  "allUsers",
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			fake := newTestServer(t)
+
+			if tt.number != 0 {
+				fake.SetProjectNumber(testProject, tt.number)
+			}
+
+			fake.SetBucketPolicy("artifacts", &storage.Policy{
+				Bindings: []*storage.PolicyBindings{{Role: tt.role, Members: []string{tt.member}}},
+			})
+
+			storageService, err := storage.NewService(ctx, fake.ClientOptions()...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := bucketReadableByAppEngine(ctx, storageService, "artifacts", testProject, fake.ClientOptions()...)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("bucketReadableByAppEngine() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got != tt.want {
+				t.Errorf("bucketReadableByAppEngine() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,208 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+// pruneVersions deletes the previous versions of the service beyond the keep
+// most recent ones. The deleted versions are recorded in state.
+func pruneVersions(
+	ctx context.Context,
+	ui terminal.UI,
+	client appengineutil.Client,
+	project string,
+	service string,
+	deployedID string,
+	keep int,
+	state *Resource_PrunedVersions,
+) error {
+	st := ui.Status()
+	defer st.Close()
+
+	st.Update("Looking for App Engine versions to prune in service '" + service + "'")
+
+	versions, err := previousVersions(ctx, client, project, service, deployedID)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error listing the App Engine versions")
+		return err
+	}
+
+	if len(versions) <= keep {
+		st.Step(terminal.StatusOK, "No App Engine version to prune")
+		return nil
+	}
+
+	st.Step(terminal.StatusOK, "Pruning "+strconv.Itoa(len(versions)-keep)+" App Engine version(s)")
+
+	// Deleting a version writes its own status to the UI.
+	st.Close()
+
+	for _, v := range versions[keep:] {
+		if err := deleteVersion(ctx, ui, client, project, service, v.Id); err != nil {
+			return err
+		}
+
+		state.VersionIds = append(state.VersionIds, v.Id)
+	}
+
+	return nil
+}
+
+// stopVersions stops the previous versions of the service which are
+// serving. The stopped versions are recorded in state.
+func stopVersions(
+	ctx context.Context,
+	ui terminal.UI,
+	client appengineutil.Client,
+	project string,
+	service string,
+	deployedID string,
+	state *Resource_StoppedVersions,
+) error {
+	st := ui.Status()
+	defer st.Close()
+
+	st.Update("Looking for App Engine versions to stop in service '" + service + "'")
+
+	versions, err := previousVersions(ctx, client, project, service, deployedID)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error listing the App Engine versions")
+		return err
+	}
+
+	for _, v := range versions {
+		if v.ServingStatus != "SERVING" {
+			continue
+		}
+
+		st.Update("Stopping App Engine version '" + v.Id + "'")
+
+		if err := setServingStatus(ctx, client, project, service, v.Id, "STOPPED"); err != nil {
+			st.Step(terminal.StatusError, "Error stopping App Engine version '"+v.Id+"'")
+			return err
+		}
+
+		st.Step(terminal.StatusOK, "App Engine version stopped '"+v.Id+"'")
+
+		state.VersionIds = append(state.VersionIds, v.Id)
+	}
+
+	return nil
+}
+
+// startVersions starts the versions of the service again. The versions
+// deleted since they were stopped are skipped.
+func startVersions(
+	ctx context.Context,
+	ui terminal.UI,
+	client appengineutil.Client,
+	project string,
+	service string,
+	versionIDs []string,
+) error {
+	st := ui.Status()
+	defer st.Close()
+
+	for _, id := range versionIDs {
+		st.Update("Starting App Engine version '" + id + "'")
+
+		err := setServingStatus(ctx, client, project, service, id, "SERVING")
+		if errors.Is(err, appengineutil.ErrNotFound) {
+			continue
+		}
+
+		if err != nil {
+			st.Step(terminal.StatusError, "Error starting App Engine version '"+id+"'")
+			return err
+		}
+
+		st.Step(terminal.StatusWarn, "App Engine version started again '"+id+"'")
+	}
+
+	return nil
+}
+
+// previousVersions returns the versions of the service other than the
+// deployed one which receive no traffic, the most recent first.
+func previousVersions(
+	ctx context.Context,
+	client appengineutil.Client,
+	project string,
+	service string,
+	deployedID string,
+) ([]*appengine.Version, error) {
+	aes, err := client.GetService(ctx, project, service)
+	if err != nil {
+		return nil, err
+	}
+
+	versions, err := client.ListVersions(ctx, project, service, "BASIC")
+	if err != nil {
+		return nil, err
+	}
+
+	var previous []*appengine.Version
+
+	for _, v := range versions {
+		if v.Id == deployedID || (aes.Split != nil && aes.Split.Allocations[v.Id] > 0) {
+			continue
+		}
+
+		previous = append(previous, v)
+	}
+
+	// Version ids are not ordered when they are set by hand, the ones
+	// created within the same second are ordered by id.
+	sort.SliceStable(previous, func(i, j int) bool {
+		ti, tj := createTime(previous[i]), createTime(previous[j])
+		if !ti.Equal(tj) {
+			return ti.After(tj)
+		}
+
+		return previous[i].Id > previous[j].Id
+	})
+
+	return previous, nil
+}
+
+// createTime returns the creation time of the version, the zero time if it
+// cannot be parsed.
+func createTime(v *appengine.Version) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, v.CreateTime)
+	return t
+}
+
+// setServingStatus starts or stops the version and waits for the update to
+// finish.
+func setServingStatus(
+	ctx context.Context,
+	client appengineutil.Client,
+	project string,
+	service string,
+	versionID string,
+	status string,
+) error {
+	op, err := client.PatchVersion(
+		ctx, project, service, versionID,
+		&appengine.Version{ServingStatus: status}, "servingStatus",
+	)
+	if err != nil {
+		return err
+	}
+
+	op, err = appengineutil.WaitForOperation(ctx, client, op)
+	if err != nil {
+		return err
+	}
+
+	return appengineutil.OperationError(op)
+}
@@ -0,0 +1,117 @@
+package platform
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"google.golang.org/api/option"
+	"google.golang.org/api/storage/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+// refsPrefix is the prefix of the objects recording which deployments use a
+// version, in the staging bucket.
+const refsPrefix = "waypoint-appengine/refs/"
+
+// versionRefs records which deployments use each version, so that a version
+// reused by several deployments is only deleted with the last of them. A
+// reference is an empty object named after the version and the deployment,
+// App Engine versions have no labels and their env variables cannot be
+// updated.
+type versionRefs struct {
+	storage *storage.Service
+	bucket  string
+	project string
+
+	// ref identifies the deployment the references are held for.
+	ref string
+}
+
+// newVersionRefs returns the references held by the deployment ref, stored
+// in the staging bucket.
+func newVersionRefs(
+	ctx context.Context,
+	client appengineutil.Client,
+	project string,
+	stagingBucket string,
+	ref string,
+	opts ...option.ClientOption,
+) (*versionRefs, error) {
+	bucket, err := stagingBucketName(ctx, client, project, stagingBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	storageService, err := storage.NewService(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	return &versionRefs{storage: storageService, bucket: bucket, project: project, ref: ref}, nil
+}
+
+// newRef returns a random reference for deployments Waypoint gave no id.
+func newRef() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// dir returns the prefix of the references to the version.
+func (r *versionRefs) dir(service, versionID string) string {
+	return refsPrefix + r.project + "/" + service + "/" + versionID + "/"
+}
+
+// add records that the deployment uses the version.
+func (r *versionRefs) add(ctx context.Context, service, versionID string) error {
+	obj := &storage.Object{Name: r.dir(service, versionID) + r.ref}
+
+	_, err := r.storage.Objects.Insert(r.bucket, obj).Media(bytes.NewReader(nil)).Context(ctx).Do()
+
+	return err
+}
+
+// remove records that the deployment no longer uses the version.
+// Deployments recorded before references were tracked hold none.
+func (r *versionRefs) remove(ctx context.Context, service, versionID string) error {
+	if r.ref == "" {
+		return nil
+	}
+
+	err := r.storage.Objects.Delete(r.bucket, r.dir(service, versionID)+r.ref).Context(ctx).Do()
+	if errors.Is(appengineutil.APIError(err), appengineutil.ErrNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// others returns the other deployments using the version.
+func (r *versionRefs) others(ctx context.Context, service, versionID string) ([]string, error) {
+	dir := r.dir(service, versionID)
+
+	var refs []string
+
+	err := r.storage.Objects.List(r.bucket).Prefix(dir).Pages(ctx, func(objs *storage.Objects) error {
+		for _, obj := range objs.Items {
+			if ref := strings.TrimPrefix(obj.Name, dir); ref != r.ref {
+				refs = append(refs, ref)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return refs, nil
+}
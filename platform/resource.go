@@ -0,0 +1,366 @@
+package platform
+
+import (
+	"context"
+	"errors"
+
+	"github.com/golang/protobuf/ptypes/any"
+	"github.com/hashicorp/go-multierror"
+	"github.com/hashicorp/waypoint-plugin-sdk/component"
+	"github.com/hashicorp/waypoint-plugin-sdk/framework/resource"
+	pb "github.com/hashicorp/waypoint-plugin-sdk/proto/gen"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/option"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+// The names of the resources a deployment manages in a service. They are
+// recorded in the state of the deployments and must not change.
+const (
+	resourceVersion         = "version"
+	resourceRef             = "version ref"
+	resourcePrunedVersions  = "pruned versions"
+	resourceStoppedVersions = "stopped versions"
+)
+
+// versionPlan is the version a deployment creates, or reuses, in a service.
+type versionPlan struct {
+	version *appengine.Version
+	reused  bool
+
+	// created is set once App Engine accepted the version, it exists even
+	// if its build fails afterwards.
+	created bool
+}
+
+// serviceResources returns the manager of the resources a deployment
+// manages in the service: its version, the reference of the deployment to
+// the version and the older versions of the service it pruned and stopped.
+// They are created in that order, each create function takes the state of
+// the previous resource to depend on it.
+//
+// plan is the version to deploy, it is nil when destroying a deployment.
+// A failed deployment is rolled back by destroying the resources it
+// created: the version unless it is reused or CleanupOnFailure is false,
+// and the stopped versions are started again. Destroying a deployment
+// deletes its version once no other deployment uses it, and leaves the
+// versions it stopped stopped. The pruned versions cannot be restored.
+func (p *Platform) serviceResources(
+	client appengineutil.Client,
+	refs *versionRefs,
+	project string,
+	service string,
+	fallbackVersion string,
+	plan *versionPlan,
+) *resource.Manager {
+	return resource.NewManager(
+		resource.WithResource(resource.NewResource(
+			resource.WithName(resourceVersion),
+			resource.WithState(&Resource_Version{}),
+			resource.WithCreate(func(ctx context.Context, ui terminal.UI, state *Resource_Version) error {
+				state.Service = service
+
+				if plan.reused {
+					state.VersionId = plan.version.Id
+					return nil
+				}
+
+				created, err := createVersion(ctx, ui, client, project, service, plan.version, p.clientOptions...)
+				if created {
+					plan.created = true
+					state.VersionId = plan.version.Id
+				}
+
+				return err
+			}),
+			resource.WithDestroy(func(ctx context.Context, ui terminal.UI, state *Resource_Version) error {
+				if state.VersionId == "" {
+					return nil
+				}
+
+				// A failed deployment leaves the versions it did not create
+				// alone, and the ones it created when told to keep them.
+				if plan != nil && (plan.reused || !p.cleanupOnFailure()) {
+					return nil
+				}
+
+				return p.destroyVersion(ctx, ui, client, refs, project, service, state.VersionId, fallbackVersion)
+			}),
+		)),
+		resource.WithResource(resource.NewResource(
+			resource.WithName(resourceRef),
+			resource.WithState(&Resource_Ref{}),
+			resource.WithCreate(func(
+				ctx context.Context, ui terminal.UI, version *Resource_Version, state *Resource_Ref,
+			) error {
+				st := ui.Status()
+				defer st.Close()
+
+				st.Update("Recording the use of App Engine version '" + version.VersionId + "'")
+
+				if err := refs.add(ctx, service, version.VersionId); err != nil {
+					st.Step(terminal.StatusError, "Error recording the use of the App Engine version in '"+refs.bucket+"'")
+					return err
+				}
+
+				state.Service = service
+				state.VersionId = version.VersionId
+
+				return nil
+			}),
+			resource.WithDestroy(func(ctx context.Context, ui terminal.UI, state *Resource_Ref) error {
+				if state.VersionId == "" {
+					return nil
+				}
+
+				st := ui.Status()
+				defer st.Close()
+
+				st.Update("Removing the use of App Engine version '" + state.VersionId + "'")
+
+				if err := refs.remove(ctx, service, state.VersionId); err != nil {
+					st.Step(terminal.StatusError, "Error removing the reference to the App Engine version")
+					return err
+				}
+
+				return nil
+			}),
+		)),
+		resource.WithResource(resource.NewResource(
+			resource.WithName(resourcePrunedVersions),
+			resource.WithState(&Resource_PrunedVersions{}),
+			resource.WithCreate(func(
+				ctx context.Context, ui terminal.UI, _ *Resource_Ref, state *Resource_PrunedVersions,
+			) error {
+				state.Service = service
+
+				if p.config.KeepVersions == nil {
+					return nil
+				}
+
+				return pruneVersions(ctx, ui, client, project, service, plan.version.Id, *p.config.KeepVersions, state)
+			}),
+		)),
+		resource.WithResource(resource.NewResource(
+			resource.WithName(resourceStoppedVersions),
+			resource.WithState(&Resource_StoppedVersions{}),
+			resource.WithCreate(func(
+				ctx context.Context, ui terminal.UI, _ *Resource_PrunedVersions, state *Resource_StoppedVersions,
+			) error {
+				state.Service = service
+
+				if !p.config.StopPreviousVersions {
+					return nil
+				}
+
+				return stopVersions(ctx, ui, client, project, service, plan.version.Id, state)
+			}),
+			resource.WithDestroy(func(ctx context.Context, ui terminal.UI, state *Resource_StoppedVersions) error {
+				if plan == nil {
+					return nil
+				}
+
+				return startVersions(ctx, ui, client, project, service, state.VersionIds)
+			}),
+		)),
+	)
+}
+
+// createResources creates the resources of the manager, which destroys the
+// created ones when a creation fails. The manager appends the error of the
+// rollback to the creation error in a *multierror.Error, which would hide
+// the status of the creation error from Waypoint, so it is returned apart.
+func createResources(rm *resource.Manager, args ...interface{}) (err, rollbackErr error) {
+	err = rm.CreateAll(args...)
+
+	var merr *multierror.Error
+	if errors.As(err, &merr) && len(merr.Errors) == 2 {
+		return merr.Errors[0], errors.Unwrap(merr.Errors[1])
+	}
+
+	return err, nil
+}
+
+// legacyResourceState returns the state of the resources of a version
+// deployed before the deployments recorded it: only the version and the
+// reference to it were managed.
+func legacyResourceState(v *Deployment_Version) (*any.Any, error) {
+	version, err := component.ProtoAny(&Resource_Version{Service: v.Service, VersionId: v.VersionId})
+	if err != nil {
+		return nil, err
+	}
+
+	ref, err := component.ProtoAny(&Resource_Ref{Service: v.Service, VersionId: v.VersionId})
+	if err != nil {
+		return nil, err
+	}
+
+	return component.ProtoAny(&pb.Framework_ResourceManagerState{
+		Resources: []*pb.Framework_ResourceState{
+			{Name: resourceVersion, Raw: version},
+			{Name: resourceRef, Raw: ref},
+		},
+		CreateOrder: []string{resourceVersion, resourceRef},
+	})
+}
+
+// destroyVersion deletes a version deployed by a destroyed deployment, along
+// with its service if it is the last version and DeleteServiceWhenEmpty is
+// set. Its traffic is moved to fallbackVersion when DestroyPolicy is
+// "fallback". A version still used by other deployments is kept.
+func (p *Platform) destroyVersion(
+	ctx context.Context,
+	ui terminal.UI,
+	client appengineutil.Client,
+	refs *versionRefs,
+	project string,
+	service string,
+	versionID string,
+	fallbackVersion string,
+) error {
+	used, err := usedByOthers(ctx, ui, refs, service, versionID)
+	if err != nil || used {
+		return err
+	}
+
+	if p.config.DeleteServiceWhenEmpty && service != defaultService {
+		last, err := isLastVersion(ctx, client, project, service, versionID)
+		if err != nil {
+			return err
+		}
+
+		// App Engine does not allow deleting the last version of a
+		// service, deleting the service deletes the version too.
+		if last {
+			return deleteService(ctx, ui, client, project, service)
+		}
+	}
+
+	err = drainTraffic(
+		ctx, ui, client,
+		project, service, versionID,
+		p.config.DestroyPolicy, fallbackVersion,
+	)
+	if err != nil {
+		return err
+	}
+
+	return deleteVersion(ctx, ui, client, project, service, versionID)
+}
+
+// createVersion creates the version and waits for it to be built.
+func createVersion(
+	ctx context.Context,
+	ui terminal.UI,
+	client appengineutil.Client,
+	project string,
+	service string,
+	aev *appengine.Version,
+	opts ...option.ClientOption,
+) (bool, error) {
+	st := ui.Status()
+	defer st.Close()
+
+	st.Update("Creating new App Engine version '" + aev.Id + "'")
+
+	op, err := client.CreateVersion(ctx, project, service, aev)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error creating new App Engine service version")
+		return false, err
+	}
+
+	st.Step(terminal.StatusOK, "App Engine version created '"+aev.Id+"'")
+
+	// The build logs are streamed in a step group, no other output may be
+	// written to the UI while the status is live.
+	st.Close()
+
+	if _, err := waitForBuild(ctx, ui, client, project, op, opts...); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
+
+// deleteVersion deletes the version and waits for the deletion to finish.
+func deleteVersion(
+	ctx context.Context,
+	ui terminal.UI,
+	client appengineutil.Client,
+	project string,
+	service string,
+	versionID string,
+) error {
+	st := ui.Status()
+	defer st.Close()
+
+	st.Update(
+		"Deleting App Engine version '" +
+			"apps/" + project + "/services/" + service + "/versions/" + versionID +
+			"'",
+	)
+
+	op, err := client.DeleteVersion(ctx, project, service, versionID)
+	if errors.Is(err, appengineutil.ErrNotFound) {
+		st.Step(terminal.StatusOK, "App Engine version already deleted '"+versionID+"'")
+		return nil
+	}
+
+	if err != nil {
+		st.Step(terminal.StatusError, "Error deleting App Engine version")
+		return err
+	}
+
+	op, err = appengineutil.WaitForOperation(ctx, client, op)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error fetching delete operation status")
+		return err
+	}
+
+	if err := appengineutil.OperationError(op); err != nil {
+		st.Step(terminal.StatusError, "Error deleting App Engine version")
+		return err
+	}
+
+	st.Step(terminal.StatusOK, "App Engine Version deleted '"+versionID+"'")
+
+	return nil
+}
+
+// deleteService deletes the service, with all its versions, and waits for
+// the deletion to finish.
+func deleteService(
+	ctx context.Context,
+	ui terminal.UI,
+	client appengineutil.Client,
+	project string,
+	service string,
+) error {
+	st := ui.Status()
+	defer st.Close()
+
+	st.Update("Deleting App Engine service '" + "apps/" + project + "/services/" + service + "'")
+
+	op, err := client.DeleteService(ctx, project, service)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error deleting App Engine service")
+		return err
+	}
+
+	op, err = appengineutil.WaitForOperation(ctx, client, op)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error fetching delete operation status")
+		return err
+	}
+
+	if err := appengineutil.OperationError(op); err != nil {
+		st.Step(terminal.StatusError, "Error deleting App Engine service")
+		return err
+	}
+
+	st.Step(terminal.StatusOK, "App Engine service deleted '"+service+"'")
+
+	return nil
+}
@@ -0,0 +1,187 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/component"
+	"github.com/hashicorp/waypoint-plugin-sdk/framework/resource"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"github.com/sharkyze/waypoint-plugin-cloudstorage/registry"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+func Test_createResources(t *testing.T) {
+	buildErr := &appengineutil.Error{Kind: appengineutil.BuildFailed, Code: codes.FailedPrecondition, Message: "build failed"}
+
+	tests := []struct {
+		name            string
+		destroyErr      error
+		wantRollbackErr bool
+		wantCalls       []string
+	}{
+		{
+			name:      "rolled back",
+			wantCalls: []string{"create version", "create ref", "destroy ref", "destroy version"},
+		},
+		{
+			name:            "rollback failure",
+			destroyErr:      errors.New("permission denied"),
+			wantRollbackErr: true,
+			wantCalls:       []string{"create version", "create ref", "destroy ref"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+
+			rm := resource.NewManager(
+				resource.WithResource(resource.NewResource(
+					resource.WithName(resourceVersion),
+					resource.WithState(&Resource_Version{}),
+					resource.WithCreate(func(state *Resource_Version) error {
+						calls = append(calls, "create version")
+						state.VersionId = "v1"
+
+						return nil
+					}),
+					resource.WithDestroy(func(state *Resource_Version) error {
+						calls = append(calls, "destroy version")
+						return nil
+					}),
+				)),
+				resource.WithResource(resource.NewResource(
+					resource.WithName(resourceRef),
+					resource.WithState(&Resource_Ref{}),
+					resource.WithCreate(func(_ *Resource_Version, state *Resource_Ref) error {
+						calls = append(calls, "create ref")
+						return buildErr
+					}),
+					resource.WithDestroy(func(state *Resource_Ref) error {
+						calls = append(calls, "destroy ref")
+						return tt.destroyErr
+					}),
+				)),
+			)
+
+			err, rollbackErr := createResources(rm)
+
+			// The status of the creation error reaches Waypoint.
+			if s, ok := status.FromError(err); !ok || s.Code() != codes.FailedPrecondition {
+				t.Errorf("createResources() error = %v, want a %v status", err, codes.FailedPrecondition)
+			}
+
+			if (rollbackErr != nil) != tt.wantRollbackErr {
+				t.Errorf("createResources() rollback error = %v, wantErr %v", rollbackErr, tt.wantRollbackErr)
+			}
+
+			if !reflect.DeepEqual(calls, tt.wantCalls) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestPlatform_deploy_previousVersions(t *testing.T) {
+	ctx := context.Background()
+	fake := newTestServer(t)
+
+	// v1 receives the traffic, the previous versions are ordered by id as
+	// they are created within the same second.
+	for _, id := range []string{"v1", "v2", "v3", "v4"} {
+		fake.AddVersion(testProject, testService, &appengine.Version{Id: id, Runtime: "go114"})
+	}
+
+	keep := 1
+	config := testConfig()
+	config.KeepVersions = &keep
+	config.StopPreviousVersions = true
+
+	p := &Platform{config: config, clientOptions: fake.ClientOptions()}
+	src := &component.Source{App: "webapp"}
+
+	d, err := p.deploy(ctx, src, nil, nil, &registry.Artifact{Source: testArtifact}, nil, terminal.NonInteractiveUI(ctx))
+	if err != nil {
+		t.Fatalf("deploy() error = %v", err)
+	}
+
+	want := []string{d.VersionId, "v1", "v4"}
+	sort.Strings(want)
+
+	if got := fake.Versions(testProject, testService); !reflect.DeepEqual(got, want) {
+		t.Errorf("deploy() versions = %v, want %v", got, want)
+	}
+
+	wantStatus := map[string]string{"v1": "SERVING", "v4": "STOPPED"}
+
+	for id, want := range wantStatus {
+		if got := fake.Version(testProject, testService, id).ServingStatus; got != want {
+			t.Errorf("deploy() serving status of %q = %q, want %q", id, got, want)
+		}
+	}
+
+	// Destroying the deployment leaves the previous versions stopped.
+	if err := p.destroy(ctx, terminal.NonInteractiveUI(ctx), d); err != nil {
+		t.Fatalf("destroy() error = %v", err)
+	}
+
+	if got := fake.Versions(testProject, testService); !reflect.DeepEqual(got, []string{"v1", "v4"}) {
+		t.Errorf("destroy() versions = %v, want %v", got, []string{"v1", "v4"})
+	}
+
+	if got := fake.Version(testProject, testService, "v4").ServingStatus; got != "STOPPED" {
+		t.Errorf("destroy() serving status of %q = %q, want %q", "v4", got, "STOPPED")
+	}
+}
+
+func TestPlatform_deploy_stoppedVersionsRestarted(t *testing.T) {
+	ctx := context.Background()
+	fake := newTestServer(t)
+
+	for _, service := range []string{"api", "worker"} {
+		fake.AddVersion(testProject, service, &appengine.Version{Id: "v1", Runtime: "go114"})
+		fake.AddVersion(testProject, service, &appengine.Version{Id: "v2", Runtime: "go114"})
+	}
+
+	fake.FailBuilds(testProject, "worker", "Build failed")
+
+	config := testConfig()
+	config.Service = ""
+	config.Parallelism = 1
+	config.StopPreviousVersions = true
+	config.Services = []serviceConfig{{Name: "api"}, {Name: "worker"}}
+
+	p := &Platform{config: config, clientOptions: fake.ClientOptions()}
+	src := &component.Source{App: "webapp"}
+
+	_, err := p.deploy(ctx, src, nil, nil, &registry.Artifact{Source: testArtifact}, nil, terminal.NonInteractiveUI(ctx))
+	if status.Code(err) != codes.FailedPrecondition {
+		t.Fatalf("deploy() error = %v, want a %v status", err, codes.FailedPrecondition)
+	}
+
+	// The api version stopped by the failed deployment is started again.
+	if got := fake.Versions(testProject, "api"); !reflect.DeepEqual(got, []string{"v1", "v2"}) {
+		t.Errorf("deploy() versions = %v, want %v", got, []string{"v1", "v2"})
+	}
+
+	if got := fake.Version(testProject, "api", "v2").ServingStatus; got != "SERVING" {
+		t.Errorf("deploy() serving status of %q = %q, want %q", "v2", got, "SERVING")
+	}
+
+	var stopped bool
+
+	for _, r := range fake.Requests() {
+		stopped = stopped || r == "PATCH /v1/apps/"+testProject+"/services/api/versions/v2"
+	}
+
+	if !stopped {
+		t.Errorf("deploy() requests = %v, want version %q stopped", fake.Requests(), "v2")
+	}
+}
@@ -0,0 +1,270 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/framework/resource"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+// defaultParallelism is the default maximum number of services deployed at
+// the same time.
+const defaultParallelism = 3
+
+type serviceConfig struct {
+	// Name: Name of the service.
+	Name string `hcl:"name,label"`
+
+	// Runtime: Desired runtime. Example: go114.
+	Runtime string `hcl:"runtime,optional"`
+
+	// InstanceClass: Instance class that is used to run this version.
+	InstanceClass string `hcl:"instance_class,optional"`
+
+	// EnvVars: Env variables of the version, merged with the app-level
+	// ones.
+	EnvVars map[string]string `hcl:"env_variables,optional"`
+
+	// RuntimeMainExecutablePath: Path of the main package, for example
+	// github.com/org/project/cmd/worker.
+	RuntimeMainExecutablePath string `hcl:"main,optional"`
+
+	// AutomaticScaling: Automatic scaling settings of the version.
+	AutomaticScaling *automaticScaling `hcl:"automatic_scaling,block"`
+
+	// Handlers: Handlers of the version, replacing the app-level ones.
+	Handlers handlers `hcl:"handlers,block"`
+
+	// DestroyFallbackVersion: Version of the service receiving the traffic
+	// of the destroyed version, replacing the app-level one.
+	DestroyFallbackVersion string `hcl:"destroy_fallback_version,optional"`
+}
+
+// serviceConfigs returns the services to deploy, with the app-level settings
+// applied. Without service blocks, the only service is Service.
+func (c *DeployConfig) serviceConfigs() []serviceConfig {
+	if len(c.Services) == 0 {
+		return []serviceConfig{{
+			Name:                      c.Service,
+			Runtime:                   c.Runtime,
+			InstanceClass:             c.InstanceClass,
+			EnvVars:                   c.EnvVars,
+			RuntimeMainExecutablePath: c.RuntimeMainExecutablePath,
+			AutomaticScaling:          c.AutomaticScaling,
+			Handlers:                  c.Handlers,
+			DestroyFallbackVersion:    c.DestroyFallbackVersion,
+		}}
+	}
+
+	services := make([]serviceConfig, len(c.Services))
+
+	for i, s := range c.Services {
+		if s.Runtime == "" {
+			s.Runtime = c.Runtime
+		}
+
+		if s.InstanceClass == "" {
+			s.InstanceClass = c.InstanceClass
+		}
+
+		if s.RuntimeMainExecutablePath == "" {
+			s.RuntimeMainExecutablePath = c.RuntimeMainExecutablePath
+		}
+
+		if s.AutomaticScaling == nil {
+			s.AutomaticScaling = c.AutomaticScaling
+		}
+
+		if len(s.Handlers) == 0 {
+			s.Handlers = c.Handlers
+		}
+
+		if s.DestroyFallbackVersion == "" {
+			s.DestroyFallbackVersion = c.DestroyFallbackVersion
+		}
+
+		s.EnvVars = withEnvVars(c.EnvVars, s.EnvVars)
+		services[i] = s
+	}
+
+	return services
+}
+
+// destroyFallbackVersion returns the fallback version of the service named
+// name in the configuration. Deployments recorded before the names were
+// recorded use the app-level one.
+func (c *DeployConfig) destroyFallbackVersion(name string) string {
+	for _, s := range c.Services {
+		if s.Name == name && s.DestroyFallbackVersion != "" {
+			return s.DestroyFallbackVersion
+		}
+	}
+
+	return c.DestroyFallbackVersion
+}
+
+// validateServices checks the services configuration.
+func (c *DeployConfig) validateServices() error {
+	if c.Parallelism < 0 {
+		return errors.New("Parallelism should not be negative")
+	}
+
+	// The service blocks replace the single service, it would be ignored.
+	if c.Service != "" && len(c.Services) > 0 {
+		return errors.New("Service should not be set along with service blocks")
+	}
+
+	names := make(map[string]bool, len(c.Services))
+
+	for _, s := range c.serviceConfigs() {
+		if s.Name == "" {
+			return errors.New("Service name should not be empty")
+		}
+
+		if names[s.Name] {
+			return fmt.Errorf("Service %q is configured more than once", s.Name)
+		}
+
+		names[s.Name] = true
+
+		if s.Runtime == "" {
+			return errors.New("Runtime should not be empty")
+		}
+	}
+
+	return nil
+}
+
+// deployServices deploys the services concurrently, at most Parallelism at
+// a time, each in its own step. If any of them fails, the versions created
+// for the others are deleted unless CleanupOnFailure is false.
+func (p *Platform) deployServices(
+	ctx context.Context,
+	ui terminal.UI,
+	client appengineutil.Client,
+	services []serviceConfig,
+	source *versionSource,
+	refs *versionRefs,
+	metadata map[string]string,
+) ([]*Deployment_Version, error) {
+	parallelism := p.config.Parallelism
+	if parallelism == 0 {
+		parallelism = defaultParallelism
+	}
+
+	type result struct {
+		version *Deployment_Version
+		rm      *resource.Manager
+		err     error
+	}
+
+	results := make([]result, len(services))
+	sem := make(chan struct{}, parallelism)
+
+	var wg sync.WaitGroup
+
+	sg := ui.StepGroup()
+
+	for i, sc := range services {
+		step := sg.Add("Waiting to deploy service '" + sc.Name + "'")
+
+		wg.Add(1)
+
+		go func(i int, sc serviceConfig, step terminal.Step) {
+			defer wg.Done()
+
+			select {
+			case sem <- struct{}{}:
+				defer func() { <-sem }()
+			case <-ctx.Done():
+				results[i] = result{err: ctx.Err()}
+
+				step.Update("Deployment of service '" + sc.Name + "' canceled")
+				step.Abort()
+
+				return
+			}
+
+			step.Update("Deploying service '" + sc.Name + "'")
+
+			version, rm, err := p.deployService(ctx, &stepUI{UI: ui, step: step}, client, sc, source, refs, metadata)
+			results[i] = result{version: version, rm: rm, err: err}
+
+			switch {
+			case errors.Is(err, errDryRun):
+				step.Update("Dry run of service '" + sc.Name + "'")
+				step.Done()
+			case err != nil:
+				step.Update("Error deploying service '" + sc.Name + "'")
+				step.Status(terminal.StatusError)
+				step.Abort()
+			default:
+				step.Update("Service '" + sc.Name + "' deployed, version '" + version.VersionId + "'")
+				step.Done()
+			}
+		}(i, sc, step)
+	}
+
+	wg.Wait()
+	sg.Wait()
+
+	var (
+		failures []error
+		versions []*Deployment_Version
+		dryRun   bool
+	)
+
+	for i, r := range results {
+		switch {
+		case errors.Is(r.err, errDryRun):
+			dryRun = true
+		case r.err != nil:
+			failures = append(failures, appengineutil.Annotate(r.err, "service '"+services[i].Name+"'"))
+		default:
+			versions = append(versions, r.version)
+		}
+	}
+
+	if len(failures) == 0 && dryRun {
+		return nil, errDryRun
+	}
+
+	if len(failures) == 0 {
+		return versions, nil
+	}
+
+	if !p.cleanupOnFailure() {
+		return nil, firstError(failures)
+	}
+
+	// The deployment fails as a whole, the resources of the other services
+	// are destroyed: the versions created would never be released and the
+	// versions reused are no longer used by this deployment.
+	for i, r := range results {
+		if r.err != nil {
+			continue
+		}
+
+		if err := r.rm.DestroyAll(ctx, ui); err != nil {
+			failures = append(failures, fmt.Errorf("rolling back service '%s': %w", services[i].Name, err))
+		}
+	}
+
+	return nil, firstError(failures)
+}
+
+// firstError returns the first of the errors annotated with the others, so
+// that the status of the first failure reaches Waypoint.
+func firstError(errs []error) error {
+	err := errs[0]
+	for _, e := range errs[1:] {
+		err = appengineutil.Annotate(err, e.Error())
+	}
+
+	return err
+}
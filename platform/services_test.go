@@ -0,0 +1,116 @@
+package platform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDeployConfig_serviceConfigs(t *testing.T) {
+	c := &DeployConfig{
+		Service:                "ignored",
+		Runtime:                "go114",
+		InstanceClass:          "F1",
+		EnvVars:                map[string]string{"PORT": "8080", "MODE": "web"},
+		Handlers:               handlers{{URL: "/.*", Script: "auto"}},
+		DestroyFallbackVersion: "stable",
+		Services: []serviceConfig{
+			{Name: "default"},
+			{
+				Name:                   "worker",
+				Runtime:                "go115",
+				EnvVars:                map[string]string{"MODE": "worker"},
+				Handlers:               handlers{},
+				DestroyFallbackVersion: "worker-stable",
+			},
+		},
+	}
+
+	want := []serviceConfig{
+		{
+			Name:                   "default",
+			Runtime:                "go114",
+			InstanceClass:          "F1",
+			EnvVars:                map[string]string{"PORT": "8080", "MODE": "web"},
+			Handlers:               handlers{{URL: "/.*", Script: "auto"}},
+			DestroyFallbackVersion: "stable",
+		},
+		{
+			Name:                   "worker",
+			Runtime:                "go115",
+			InstanceClass:          "F1",
+			EnvVars:                map[string]string{"PORT": "8080", "MODE": "worker"},
+			Handlers:               handlers{{URL: "/.*", Script: "auto"}},
+			DestroyFallbackVersion: "worker-stable",
+		},
+	}
+
+	if got := c.serviceConfigs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("serviceConfigs() = %+v, want %+v", got, want)
+	}
+
+	for name, want := range map[string]string{"default": "stable", "worker": "worker-stable", "": "stable"} {
+		if got := c.destroyFallbackVersion(name); got != want {
+			t.Errorf("destroyFallbackVersion(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestDeployConfig_validateServices(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  DeployConfig
+		wantErr bool
+	}{
+		{
+			name:   "single service",
+			config: DeployConfig{Service: "api", Runtime: "go114"},
+		},
+		{
+			name:    "single service without runtime",
+			config:  DeployConfig{Service: "api"},
+			wantErr: true,
+		},
+		{
+			name: "service blocks",
+			config: DeployConfig{Runtime: "go114", Services: []serviceConfig{
+				{Name: "api"},
+				{Name: "worker", Runtime: "go115"},
+			}},
+		},
+		{
+			name: "service block without runtime",
+			config: DeployConfig{Services: []serviceConfig{
+				{Name: "api", Runtime: "go114"},
+				{Name: "worker"},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "duplicate service",
+			config: DeployConfig{Runtime: "go114", Services: []serviceConfig{
+				{Name: "api"},
+				{Name: "api"},
+			}},
+			wantErr: true,
+		},
+		{
+			name: "service attribute and service blocks",
+			config: DeployConfig{Service: "api", Runtime: "go114", Services: []serviceConfig{
+				{Name: "worker"},
+			}},
+			wantErr: true,
+		},
+		{
+			name:    "negative parallelism",
+			config:  DeployConfig{Service: "api", Runtime: "go114", Parallelism: -1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.validateServices(); (err != nil) != tt.wantErr {
+				t.Errorf("validateServices() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
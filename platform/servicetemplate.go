@@ -0,0 +1,93 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+const (
+	serviceTemplateService = "${service}"
+	serviceTemplateBranch  = "${branch}"
+)
+
+// branchEnvVars are the env variables CI systems set to the branch being
+// built, in the order they are looked up. CI systems usually check out a
+// detached HEAD, where git does not know the branch.
+var branchEnvVars = []string{
+	"GITHUB_HEAD_REF",    // GitHub Actions, pull requests only
+	"CI_COMMIT_REF_NAME", // GitLab CI
+	"BRANCH_NAME",        // Cloud Build, Jenkins
+	"CIRCLE_BRANCH",      // CircleCI
+}
+
+// errDetachedHead is returned when the branch is looked up in a git
+// checkout with a detached HEAD.
+var errDetachedHead = errors.New("the git checkout is on a detached HEAD")
+
+// resolveService renders the service template, if any, and sanitizes the
+// result to a valid App Engine service name. The branch is only resolved
+// when the template references it, see resolveBranch.
+func resolveService(ctx context.Context, template, service, branch, path string) (string, error) {
+	if template == "" {
+		return service, nil
+	}
+
+	s := strings.ReplaceAll(template, serviceTemplateService, service)
+
+	if strings.Contains(s, serviceTemplateBranch) {
+		branch, err := resolveBranch(ctx, branch, path)
+		if err != nil {
+			return "", err
+		}
+
+		s = strings.ReplaceAll(s, serviceTemplateBranch, branch)
+	}
+
+	name := appengineutil.SanitizeServiceName(s)
+	if name == "" {
+		return "", fmt.Errorf("service template %q resolves to an empty service name", template)
+	}
+
+	return name, nil
+}
+
+// resolveBranch returns the configured branch if set, else the branch from
+// the first of branchEnvVars set, else the current branch of the git
+// repository at path.
+func resolveBranch(ctx context.Context, branch, path string) (string, error) {
+	if branch != "" {
+		return branch, nil
+	}
+
+	for _, name := range branchEnvVars {
+		if v := os.Getenv(name); v != "" {
+			return v, nil
+		}
+	}
+
+	branch, err := gitBranch(ctx, path)
+	if err != nil {
+		return "", fmt.Errorf("resolving the git branch: %w", err)
+	}
+
+	// All the previews would be deployed to the same service.
+	if branch == "HEAD" {
+		return "", fmt.Errorf(
+			"resolving the git branch: %w, set branch or one of the %s env variables",
+			errDetachedHead, strings.Join(branchEnvVars, ", "),
+		)
+	}
+
+	return branch, nil
+}
+
+// gitBranch returns the current branch of the git repository at path, or
+// HEAD when the HEAD is detached.
+func gitBranch(ctx context.Context, path string) (string, error) {
+	return git(ctx, path, "rev-parse", "--abbrev-ref", "HEAD")
+}
@@ -0,0 +1,130 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func Test_resolveService(t *testing.T) {
+	const branchEnvVar = "WAYPOINT_APPENGINE_TEST_BRANCH"
+
+	envVars := branchEnvVars
+	branchEnvVars = []string{branchEnvVar}
+
+	defer func() { branchEnvVars = envVars }()
+
+	tests := []struct {
+		name     string
+		template string
+		branch   string
+		env      string
+		repo     func(t *testing.T) string
+		want     string
+		wantErr  bool
+		detached bool
+	}{
+		{
+			name: "no template",
+			want: "api",
+		},
+		{
+			name:     "service only",
+			template: "${service}-preview",
+			want:     "api-preview",
+		},
+		{
+			name:     "configured branch",
+			template: "${service}-${branch}",
+			branch:   "PR/123",
+			env:      "ignored",
+			want:     "api-pr-123",
+		},
+		{
+			name:     "branch env variable",
+			template: "${service}-${branch}",
+			env:      "feature/new_login",
+			repo:     func(t *testing.T) string { return gitRepo(t, "main", true) },
+			want:     "api-feature-new-login",
+		},
+		{
+			name:     "git branch",
+			template: "${service}-${branch}",
+			repo:     func(t *testing.T) string { return gitRepo(t, "Feature.X", false) },
+			want:     "api-feature-x",
+		},
+		{
+			name:     "detached HEAD",
+			template: "${service}-${branch}",
+			repo:     func(t *testing.T) string { return gitRepo(t, "main", true) },
+			wantErr:  true,
+			detached: true,
+		},
+		{
+			name:     "empty name",
+			template: "${branch}",
+			branch:   "---",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.env != "" {
+				os.Setenv(branchEnvVar, tt.env)
+				defer os.Unsetenv(branchEnvVar)
+			}
+
+			path := t.TempDir()
+			if tt.repo != nil {
+				path = tt.repo(t)
+			}
+
+			got, err := resolveService(context.Background(), tt.template, "api", tt.branch, path)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveService() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if errors.Is(err, errDetachedHead) != tt.detached {
+				t.Errorf("resolveService() error = %v, want detached HEAD %v", err, tt.detached)
+			}
+
+			if got != tt.want {
+				t.Errorf("resolveService() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// gitRepo creates a git repository with a single commit on branch, with its
+// HEAD detached if detached is set, and returns its path.
+func gitRepo(t *testing.T, branch string, detached bool) string {
+	t.Helper()
+
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	path := t.TempDir()
+
+	commands := [][]string{
+		{"init", "--quiet"},
+		{"checkout", "--quiet", "-b", branch},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "--quiet", "--allow-empty", "-m", "init"},
+	}
+	if detached {
+		commands = append(commands, []string{"checkout", "--quiet", "--detach"})
+	}
+
+	for _, args := range commands {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = path
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+
+	return path
+}
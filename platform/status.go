@@ -0,0 +1,141 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	sdk "github.com/hashicorp/waypoint-plugin-sdk/proto/gen"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+// StatusFunc implements component.Status.
+func (p *Platform) StatusFunc() interface{} {
+	return p.status
+}
+
+// status reports the health of the versions of the deployment, from their
+// serving status and their running instances.
+func (p *Platform) status(ctx context.Context, ui terminal.UI, deployment *Deployment) (*sdk.StatusReport, error) {
+	st := ui.Status()
+	defer st.Close()
+
+	client, err := p.appengineClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var resources []*sdk.StatusReport_Resource
+
+	for _, v := range deployment.ServiceVersions() {
+		st.Update("Checking App Engine version '" + v.VersionId + "' of service '" + v.Service + "'")
+
+		rs, err := versionStatus(ctx, client, deployment.Project, v.Service, v.VersionId)
+		if err != nil {
+			st.Step(terminal.StatusError, "Error checking App Engine version '"+v.VersionId+"'")
+			return nil, err
+		}
+
+		resources = append(resources, rs...)
+	}
+
+	health, message := appengineutil.OverallHealth(resources)
+
+	st.Step(terminal.StatusOK, "Deployment status: "+health.String()+", "+message)
+
+	return &sdk.StatusReport{
+		Resources:     resources,
+		Health:        health,
+		HealthMessage: message,
+		GeneratedTime: timestamppb.Now(),
+		External:      true,
+	}, nil
+}
+
+// versionStatus reports the health of the version followed by the health of
+// each of its instances.
+func versionStatus(
+	ctx context.Context,
+	client appengineutil.Client,
+	project string,
+	service string,
+	versionID string,
+) ([]*sdk.StatusReport_Resource, error) {
+	name := "apps/" + project + "/services/" + service + "/versions/" + versionID
+
+	aev, err := client.GetVersion(ctx, project, service, versionID, "BASIC")
+	if errors.Is(err, appengineutil.ErrNotFound) {
+		return []*sdk.StatusReport_Resource{{
+			Name:          name,
+			Health:        sdk.StatusReport_DOWN,
+			HealthMessage: "Version not found",
+		}}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if aev.ServingStatus != "SERVING" {
+		return []*sdk.StatusReport_Resource{{
+			Name:          name,
+			Health:        sdk.StatusReport_DOWN,
+			HealthMessage: "Version is " + aev.ServingStatus,
+		}}, nil
+	}
+
+	instances, err := client.ListInstances(ctx, project, service, versionID)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := []*sdk.StatusReport_Resource{{
+		Name:          name,
+		Health:        sdk.StatusReport_READY,
+		HealthMessage: "Version is serving, " + strconv.Itoa(len(instances)) + " instances running",
+	}}
+
+	for _, i := range instances {
+		resources = append(resources, &sdk.StatusReport_Resource{
+			Name:          name + "/instances/" + i.Id,
+			Health:        instanceHealth(i),
+			HealthMessage: instanceMessage(i),
+		})
+	}
+
+	return resources, nil
+}
+
+// instanceHealth is DOWN when the VM of the instance, only set in the
+// flexible environment, is not running and PARTIAL when some of its requests
+// failed.
+func instanceHealth(i *appengine.Instance) sdk.StatusReport_Health {
+	switch {
+	case i.VmStatus != "" && i.VmStatus != "RUNNING":
+		return sdk.StatusReport_DOWN
+	case i.Errors > 0:
+		return sdk.StatusReport_PARTIAL
+	default:
+		return sdk.StatusReport_READY
+	}
+}
+
+func instanceMessage(i *appengine.Instance) string {
+	parts := []string{"availability " + i.Availability}
+
+	if i.VmStatus != "" {
+		parts = append(parts, "VM "+i.VmStatus)
+	}
+
+	parts = append(parts,
+		strconv.FormatInt(i.Requests, 10)+" requests",
+		strconv.FormatInt(i.Errors, 10)+" errors",
+	)
+
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,104 @@
+package platform
+
+import (
+	"context"
+	"testing"
+
+	sdk "github.com/hashicorp/waypoint-plugin-sdk/proto/gen"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appenginetest"
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+func TestPlatform_status(t *testing.T) {
+	running := &appengine.Instance{Id: "i1", Availability: "DYNAMIC", Requests: 12}
+
+	tests := []struct {
+		name          string
+		servingStatus string
+		versionErr    error
+		instances     []*appengine.Instance
+		want          sdk.StatusReport_Health
+		wantResources int
+	}{
+		{
+			name:          "serving",
+			servingStatus: "SERVING",
+			instances:     []*appengine.Instance{running},
+			want:          sdk.StatusReport_READY,
+			wantResources: 2,
+		},
+		{
+			name:          "scaled to zero",
+			servingStatus: "SERVING",
+			want:          sdk.StatusReport_READY,
+			wantResources: 1,
+		},
+		{
+			name:          "stopped",
+			servingStatus: "STOPPED",
+			want:          sdk.StatusReport_DOWN,
+			wantResources: 1,
+		},
+		{
+			name:          "deleted",
+			versionErr:    &appengineutil.Error{Kind: appengineutil.NotFound, Message: "Version not found"},
+			want:          sdk.StatusReport_DOWN,
+			wantResources: 1,
+		},
+		{
+			name:          "failing requests",
+			servingStatus: "SERVING",
+			instances:     []*appengine.Instance{running, {Id: "i2", Availability: "DYNAMIC", Requests: 5, Errors: 2}},
+			want:          sdk.StatusReport_PARTIAL,
+			wantResources: 3,
+		},
+		{
+			name:          "VM not running",
+			servingStatus: "SERVING",
+			instances:     []*appengine.Instance{{Id: "i1", Availability: "RESIDENT", VmStatus: "STAGING"}},
+			want:          sdk.StatusReport_PARTIAL,
+			wantResources: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			client := &appenginetest.MockClient{
+				GetVersionFunc: func(project, service, versionID, view string) (*appengine.Version, error) {
+					if tt.versionErr != nil {
+						return nil, tt.versionErr
+					}
+
+					return &appengine.Version{Id: versionID, ServingStatus: tt.servingStatus}, nil
+				},
+				ListInstancesFunc: func(project, service, versionID string) ([]*appengine.Instance, error) {
+					return tt.instances, nil
+				},
+			}
+
+			p := &Platform{config: testConfig(), client: client}
+			d := &Deployment{Project: testProject, Service: testService, VersionId: "v1"}
+
+			report, err := p.status(ctx, terminal.NonInteractiveUI(ctx), d)
+			if err != nil {
+				t.Fatalf("status() error = %v", err)
+			}
+
+			if report.Health != tt.want {
+				t.Errorf("status() health = %v, want %v", report.Health, tt.want)
+			}
+
+			if len(report.Resources) != tt.wantResources {
+				t.Errorf("status() resources = %v, want %d", report.Resources, tt.wantResources)
+			}
+
+			if !report.External || report.GeneratedTime == nil {
+				t.Errorf("status() = %v, want an external report with its generation time", report)
+			}
+		})
+	}
+}
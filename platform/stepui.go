@@ -0,0 +1,99 @@
+package platform
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+)
+
+// stepUI is the UI of a service deployed concurrently with other services.
+// Statuses and step groups cannot be nested in a step group, so they are
+// written to the step of the service instead.
+type stepUI struct {
+	terminal.UI
+
+	step terminal.Step
+}
+
+// Output implements terminal.UI.
+func (u *stepUI) Output(msg string, raw ...interface{}) {
+	msg, _, _ = terminal.Interpret(msg, raw...)
+	fmt.Fprintln(u.step.TermOutput(), msg)
+}
+
+// Status implements terminal.UI.
+func (u *stepUI) Status() terminal.Status {
+	return &stepStatus{step: u.step}
+}
+
+// StepGroup implements terminal.UI.
+func (u *stepUI) StepGroup() terminal.StepGroup {
+	return &stepGroup{step: u.step}
+}
+
+// Table implements terminal.UI.
+func (u *stepUI) Table(tbl *terminal.Table, _ ...terminal.Option) {
+	w := u.step.TermOutput()
+
+	fmt.Fprintln(w, strings.Join(tbl.Headers, " | "))
+
+	for _, row := range tbl.Rows {
+		values := make([]string, len(row))
+		for i, ent := range row {
+			values[i] = ent.Value
+		}
+
+		fmt.Fprintln(w, strings.Join(values, " | "))
+	}
+}
+
+// stepStatus is a terminal.Status writing to a step.
+type stepStatus struct {
+	step terminal.Step
+}
+
+func (s *stepStatus) Update(msg string) {
+	s.step.Update(msg)
+}
+
+func (s *stepStatus) Step(status, msg string) {
+	fmt.Fprintf(s.step.TermOutput(), "%s: %s\n", status, msg)
+}
+
+func (s *stepStatus) Close() error {
+	return nil
+}
+
+// stepGroup is a terminal.StepGroup whose steps write to a parent step.
+type stepGroup struct {
+	step terminal.Step
+}
+
+func (g *stepGroup) Add(msg string, args ...interface{}) terminal.Step {
+	g.step.Update(msg, args...)
+	return &nestedStep{parent: g.step}
+}
+
+func (g *stepGroup) Wait() {}
+
+// nestedStep is a step of a stepGroup. Its parent step is done or aborted
+// by its owner only.
+type nestedStep struct {
+	parent terminal.Step
+}
+
+func (s *nestedStep) TermOutput() io.Writer {
+	return s.parent.TermOutput()
+}
+
+func (s *nestedStep) Update(msg string, args ...interface{}) {
+	s.parent.Update(msg, args...)
+}
+
+func (s *nestedStep) Status(string) {}
+
+func (s *nestedStep) Done() {}
+
+func (s *nestedStep) Abort() {}
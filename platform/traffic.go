@@ -0,0 +1,137 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+const (
+	// destroyPolicyFail refuses to destroy a version receiving traffic.
+	destroyPolicyFail = "fail"
+	// destroyPolicyFallback moves the traffic of the destroyed version to
+	// the fallback version before destroying it.
+	destroyPolicyFallback = "fallback"
+)
+
+// drainTraffic makes sure the version does not receive traffic anymore
+// before it is destroyed, according to the destroy policy.
+func drainTraffic(
+	ctx context.Context,
+	ui terminal.UI,
+	client appengineutil.Client,
+	project string,
+	service string,
+	versionID string,
+	policy string,
+	fallbackVersion string,
+) error {
+	st := ui.Status()
+	defer st.Close()
+
+	st.Update("Checking traffic allocated to App Engine version '" + versionID + "'")
+
+	aes, err := client.GetService(ctx, project, service)
+	if err != nil {
+		if errors.Is(err, appengineutil.ErrNotFound) {
+			return nil
+		}
+
+		st.Step(terminal.StatusError, "Error fetching the App Engine service")
+		return err
+	}
+
+	if aes.Split == nil || aes.Split.Allocations[versionID] == 0 {
+		return nil
+	}
+
+	share := aes.Split.Allocations[versionID]
+
+	if policy != destroyPolicyFallback {
+		st.Step(terminal.StatusError, "App Engine version is receiving traffic")
+		return fmt.Errorf(
+			"version '%s' receives %s%% of the traffic of service '%s', release another version "+
+				"or set destroy_policy = %q to destroy it",
+			versionID, strconv.FormatFloat(share*100, 'f', -1, 64), service, destroyPolicyFallback,
+		)
+	}
+
+	allocations, err := moveAllocation(aes.Split.Allocations, versionID, fallbackVersion)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error moving traffic to the fallback version")
+		return err
+	}
+
+	st.Update("Checking fallback App Engine version '" + fallbackVersion + "'")
+
+	// App Engine would reject a split to a missing version with a generic
+	// error.
+	_, err = client.GetVersion(ctx, project, service, fallbackVersion, "BASIC")
+	if errors.Is(err, appengineutil.ErrNotFound) {
+		st.Step(terminal.StatusError, "Fallback App Engine version not found")
+		return fmt.Errorf(
+			"fallback version '%s' does not exist in service '%s', set destroy_fallback_version "+
+				"in the service block to a version of the service",
+			fallbackVersion, service,
+		)
+	}
+
+	if err != nil {
+		st.Step(terminal.StatusError, "Error fetching the fallback App Engine version")
+		return err
+	}
+
+	st.Update("Moving traffic from App Engine version '" + versionID + "' to '" + fallbackVersion + "'")
+
+	op, err := client.PatchService(ctx, project, service, &appengine.Service{
+		Split: &appengine.TrafficSplit{Allocations: allocations, ShardBy: aes.Split.ShardBy},
+	}, "split")
+	if err != nil {
+		st.Step(terminal.StatusError, "Error moving traffic to the fallback version")
+		return err
+	}
+
+	op, err = appengineutil.WaitForOperation(ctx, client, op)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error fetching traffic split operation status")
+		return err
+	}
+
+	if err := appengineutil.OperationError(op); err != nil {
+		st.Step(terminal.StatusError, "Error moving traffic to the fallback version")
+		return err
+	}
+
+	st.Step(terminal.StatusOK, "Traffic moved to App Engine version '"+fallbackVersion+"'")
+
+	return nil
+}
+
+// moveAllocation returns a copy of the allocations where the share of from
+// is moved to to.
+func moveAllocation(allocations map[string]float64, from, to string) (map[string]float64, error) {
+	if to == "" {
+		return nil, errors.New("no fallback version configured")
+	}
+
+	if to == from {
+		return nil, fmt.Errorf("the fallback version '%s' is the version being destroyed", to)
+	}
+
+	moved := make(map[string]float64, len(allocations))
+	for v, share := range allocations {
+		if v != from {
+			moved[v] = share
+		}
+	}
+
+	moved[to] += allocations[from]
+
+	return moved, nil
+}
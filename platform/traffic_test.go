@@ -0,0 +1,163 @@
+package platform
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appenginetest"
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+func Test_moveAllocation(t *testing.T) {
+	tests := []struct {
+		name        string
+		allocations map[string]float64
+		from        string
+		to          string
+		want        map[string]float64
+		wantErr     bool
+	}{
+		{
+			name:        "all traffic",
+			allocations: map[string]float64{"v2": 1},
+			from:        "v2",
+			to:          "v1",
+			want:        map[string]float64{"v1": 1},
+		},
+		{
+			name:        "split traffic",
+			allocations: map[string]float64{"v1": 0.5, "v2": 0.3, "v3": 0.2},
+			from:        "v2",
+			to:          "v1",
+			want:        map[string]float64{"v1": 0.8, "v3": 0.2},
+		},
+		{
+			name:        "no fallback",
+			allocations: map[string]float64{"v2": 1},
+			from:        "v2",
+			wantErr:     true,
+		},
+		{
+			name:        "fallback to itself",
+			allocations: map[string]float64{"v2": 1},
+			from:        "v2",
+			to:          "v2",
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := moveAllocation(tt.allocations, tt.from, tt.to)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("moveAllocation() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("moveAllocation() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_drainTraffic(t *testing.T) {
+	notFound := &appengineutil.Error{Kind: appengineutil.NotFound, Message: "not found"}
+
+	tests := []struct {
+		name      string
+		service   *appengine.Service
+		getErr    error
+		versions  []string
+		policy    string
+		fallback  string
+		wantErr   bool
+		wantCalls []string
+		wantSplit map[string]float64
+	}{
+		{
+			name:      "service not found",
+			getErr:    notFound,
+			wantCalls: []string{"GetService"},
+		},
+		{
+			name:      "no traffic",
+			service:   &appengine.Service{Split: &appengine.TrafficSplit{Allocations: map[string]float64{"v1": 1}}},
+			wantCalls: []string{"GetService"},
+		},
+		{
+			name:      "traffic with fail policy",
+			service:   &appengine.Service{Split: &appengine.TrafficSplit{Allocations: map[string]float64{"v2": 1}}},
+			policy:    destroyPolicyFail,
+			wantErr:   true,
+			wantCalls: []string{"GetService"},
+		},
+		{
+			name: "traffic with fallback policy",
+			service: &appengine.Service{
+				Split: &appengine.TrafficSplit{Allocations: map[string]float64{"v1": 0.5, "v2": 0.5}, ShardBy: "IP"},
+			},
+			versions:  []string{"v1", "v2"},
+			policy:    destroyPolicyFallback,
+			fallback:  "v1",
+			wantCalls: []string{"GetService", "GetVersion", "PatchService"},
+			wantSplit: map[string]float64{"v1": 1},
+		},
+		{
+			name:      "missing fallback version",
+			service:   &appengine.Service{Split: &appengine.TrafficSplit{Allocations: map[string]float64{"v2": 1}}},
+			versions:  []string{"v2"},
+			policy:    destroyPolicyFallback,
+			fallback:  "v1",
+			wantErr:   true,
+			wantCalls: []string{"GetService", "GetVersion"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			var gotSplit map[string]float64
+
+			client := &appenginetest.MockClient{
+				GetServiceFunc: func(project, service string) (*appengine.Service, error) {
+					return tt.service, tt.getErr
+				},
+				GetVersionFunc: func(project, service, versionID, view string) (*appengine.Version, error) {
+					for _, v := range tt.versions {
+						if v == versionID {
+							return &appengine.Version{Id: v}, nil
+						}
+					}
+
+					return nil, notFound
+				},
+				PatchServiceFunc: func(project, service string, aes *appengine.Service, updateMask string) (*appengine.Operation, error) {
+					if updateMask != "split" || aes.Split.ShardBy != tt.service.Split.ShardBy {
+						t.Errorf("PatchService() split = %+v, mask %q", aes.Split, updateMask)
+					}
+
+					gotSplit = aes.Split.Allocations
+
+					return appenginetest.DoneOperation(project), nil
+				},
+			}
+
+			err := drainTraffic(ctx, terminal.NonInteractiveUI(ctx), client, "project", "api", "v2", tt.policy, tt.fallback)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("drainTraffic() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(client.Calls, tt.wantCalls) {
+				t.Errorf("drainTraffic() calls = %v, want %v", client.Calls, tt.wantCalls)
+			}
+
+			if !reflect.DeepEqual(gotSplit, tt.wantSplit) {
+				t.Errorf("drainTraffic() split = %v, want %v", gotSplit, tt.wantSplit)
+			}
+		})
+	}
+}
@@ -0,0 +1,279 @@
+package platform
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+// maskedValue replaces the values of secret-looking env variables.
+const maskedValue = "********"
+
+// envVariablesPrefix is the path prefix of the env variables of a version.
+const envVariablesPrefix = "envVariables."
+
+// secretEnvKeywords are the words which make an env variable name look like
+// it holds a secret.
+var secretEnvKeywords = []string{"SECRET", "TOKEN", "PASSWORD", "PASSWD", "KEY", "CREDENTIAL", "AUTH"}
+
+// ignoredVersionFields are output only fields or fields changing on every
+// deployment, they are not part of the diff.
+var ignoredVersionFields = []string{
+	"createTime",
+	"createdBy",
+	"deployment",
+	"diskUsageBytes",
+	"id",
+	"name",
+	"servingStatus",
+	"versionUrl",
+	envVariablesPrefix + generationEnvVar,
+	envVariablesPrefix + deploymentIDEnvVar,
+	envVariablesPrefix + gitCommitEnvVar,
+	envVariablesPrefix + artifactSourceEnvVar,
+}
+
+// defaultedVersionFields are the fields App Engine fills in when the plugin
+// leaves them unset, with their default value or an empty value for any
+// value. They show up in the full view of the current version only, and are
+// not reported as removed. Indexes in the paths are replaced with [*].
+var defaultedVersionFields = []appengineutil.Field{
+	{Path: "automaticScaling.standardSchedulerSettings.targetCpuUtilization"},
+	{Path: "automaticScaling.standardSchedulerSettings.targetThroughputUtilization"},
+	{Path: "handlers[*].login", Value: "LOGIN_OPTIONAL"},
+	{Path: "handlers[*].securityLevel", Value: "SECURE_OPTIONAL"},
+	{Path: "runtimeApiVersion"},
+}
+
+// fieldIndex matches the indexes in the path of a field.
+var fieldIndex = regexp.MustCompile(`\[\d+\]`)
+
+// fieldChange is the change of a field between two versions. Before is empty
+// for added fields and After is empty for removed fields.
+type fieldChange struct {
+	Path   string
+	Before string
+	After  string
+}
+
+// masked returns the change with its values masked, keeping which of them
+// are set.
+func (c fieldChange) masked() fieldChange {
+	if c.Before != "" {
+		c.Before = maskedValue
+	}
+
+	if c.After != "" {
+		c.After = maskedValue
+	}
+
+	return c
+}
+
+func (c fieldChange) String() string {
+	switch {
+	case c.Before == "":
+		return "+ " + c.Path + ": " + c.After
+	case c.After == "":
+		return "- " + c.Path + ": " + c.Before
+	default:
+		return "~ " + c.Path + ": " + c.Before + " => " + c.After
+	}
+}
+
+// servingVersion returns the version of the service receiving the biggest
+// share of the traffic, or nil if the service does not exist yet.
+func servingVersion(
+	ctx context.Context,
+	client appengineutil.Client,
+	project string,
+	service string,
+) (*appengine.Version, error) {
+	aes, err := client.GetService(ctx, project, service)
+	if err != nil {
+		if errors.Is(err, appengineutil.ErrNotFound) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	if aes.Split == nil || len(aes.Split.Allocations) == 0 {
+		return nil, nil
+	}
+
+	var (
+		versionID string
+		share     float64
+	)
+
+	for v, s := range aes.Split.Allocations {
+		// Ties are broken by version id so the result does not depend on
+		// the map order.
+		if s > share || (s == share && v > versionID) {
+			versionID, share = v, s
+		}
+	}
+
+	return client.GetVersion(ctx, project, service, versionID, "FULL")
+}
+
+// diffVersions compares the versions field by field. The full view of the
+// current version holds the defaults App Engine filled in, such as the
+// handlers login or the scheduler settings, they are not reported as
+// removed. The values of the env variables which look like secrets are
+// compared, then masked.
+func diffVersions(current, desired *appengine.Version) ([]fieldChange, error) {
+	before, err := versionFields(current)
+	if err != nil {
+		return nil, err
+	}
+
+	after, err := versionFields(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	var changes []fieldChange
+
+	i, j := 0, 0
+	for i < len(before) || j < len(after) {
+		switch {
+		case j == len(after) || (i < len(before) && before[i].Path < after[j].Path):
+			if !defaultedVersionField(before[i]) {
+				changes = append(changes, fieldChange{Path: before[i].Path, Before: before[i].Value})
+			}
+			i++
+		case i == len(before) || after[j].Path < before[i].Path:
+			changes = append(changes, fieldChange{Path: after[j].Path, After: after[j].Value})
+			j++
+		default:
+			if before[i].Value != after[j].Value {
+				changes = append(changes, fieldChange{
+					Path:   after[j].Path,
+					Before: before[i].Value,
+					After:  after[j].Value,
+				})
+			}
+			i++
+			j++
+		}
+	}
+
+	for i, c := range changes {
+		if name := strings.TrimPrefix(c.Path, envVariablesPrefix); name != c.Path && looksSecret(name) {
+			changes[i] = c.masked()
+		}
+	}
+
+	return changes, nil
+}
+
+// versionFields flattens the version, without the ignored fields.
+func versionFields(aev *appengine.Version) ([]appengineutil.Field, error) {
+	all, err := appengineutil.Flatten(aev)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := all[:0]
+
+	for _, f := range all {
+		if ignoredVersionField(f.Path) {
+			continue
+		}
+
+		fields = append(fields, f)
+	}
+
+	return fields, nil
+}
+
+func ignoredVersionField(path string) bool {
+	for _, ignored := range ignoredVersionFields {
+		if path == ignored || strings.HasPrefix(path, ignored+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// defaultedVersionField reports whether the field of the current version
+// holds a value App Engine filled in.
+func defaultedVersionField(f appengineutil.Field) bool {
+	path := fieldIndex.ReplaceAllString(f.Path, "[*]")
+
+	for _, d := range defaultedVersionFields {
+		if path == d.Path && (d.Value == "" || f.Value == d.Value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// looksSecret reports whether the env variable name looks like it holds a
+// secret.
+func looksSecret(name string) bool {
+	name = strings.ToUpper(name)
+
+	for _, kw := range secretEnvKeywords {
+		if strings.Contains(name, kw) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// printVersionDiff prints the changes between the version serving the
+// service and the new version. It is informative only, so errors are
+// reported as warnings.
+func printVersionDiff(
+	ctx context.Context,
+	st terminal.Status,
+	client appengineutil.Client,
+	project string,
+	service string,
+	aev *appengine.Version,
+) {
+	st.Update("Comparing with the serving App Engine version")
+
+	current, err := servingVersion(ctx, client, project, service)
+	if err != nil {
+		st.Step(terminal.StatusWarn, "Could not fetch the serving App Engine version: "+err.Error())
+		return
+	}
+
+	if current == nil {
+		return
+	}
+
+	changes, err := diffVersions(current, aev)
+	if err != nil {
+		st.Step(terminal.StatusWarn, "Could not compare with the serving App Engine version: "+err.Error())
+		return
+	}
+
+	if len(changes) == 0 {
+		st.Step(terminal.StatusOK, "Config unchanged since App Engine version '"+current.Id+"'")
+		return
+	}
+
+	lines := make([]string, len(changes))
+	for i, c := range changes {
+		lines[i] = "  " + c.String()
+	}
+
+	st.Step(
+		terminal.StatusWarn,
+		"Config changes since App Engine version '"+current.Id+"':\n"+strings.Join(lines, "\n"),
+	)
+}
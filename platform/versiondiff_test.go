@@ -0,0 +1,138 @@
+package platform
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/appengine/v1"
+)
+
+func Test_diffVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		current *appengine.Version
+		desired *appengine.Version
+		want    []fieldChange
+	}{
+		{
+			name: "ignored fields",
+			current: &appengine.Version{
+				Id:            "20201021t120000",
+				Runtime:       "go114",
+				ServingStatus: "SERVING",
+				CreatedBy:     "someone@example.com",
+				EnvVariables:  map[string]string{generationEnvVar: "abc"},
+			},
+			desired: &appengine.Version{
+				Id:           "20201022t120000",
+				Runtime:      "go114",
+				Deployment:   &appengine.Deployment{Zip: &appengine.ZipInfo{SourceUrl: "gs://b/o.zip"}},
+				EnvVariables: map[string]string{generationEnvVar: "def"},
+			},
+			want: nil,
+		},
+		{
+			name: "changed, added and removed fields",
+			current: &appengine.Version{
+				InstanceClass: "F1",
+				EnvVariables:  map[string]string{"PORT": "8080", "OLD": "x"},
+			},
+			desired: &appengine.Version{
+				InstanceClass:    "F2",
+				AutomaticScaling: &appengine.AutomaticScaling{MaxConcurrentRequests: 10},
+				EnvVariables:     map[string]string{"PORT": "8080"},
+			},
+			want: []fieldChange{
+				{Path: "automaticScaling.maxConcurrentRequests", After: "10"},
+				{Path: "envVariables.OLD", Before: "x"},
+				{Path: "instanceClass", Before: "F1", After: "F2"},
+			},
+		},
+		{
+			name: "secret env values are masked",
+			current: &appengine.Version{
+				EnvVariables: map[string]string{"API_TOKEN": "old-token", "DB_PASSWORD": "same"},
+			},
+			desired: &appengine.Version{
+				EnvVariables: map[string]string{"API_TOKEN": "new-token", "DB_PASSWORD": "same", "api_key": "k"},
+			},
+			want: []fieldChange{
+				{Path: "envVariables.API_TOKEN", Before: maskedValue, After: maskedValue},
+				{Path: "envVariables.api_key", After: maskedValue},
+			},
+		},
+		{
+			name: "server defaults",
+			current: &appengine.Version{
+				Runtime:           "go114",
+				RuntimeApiVersion: "go1",
+				AutomaticScaling: &appengine.AutomaticScaling{
+					MaxTotalInstances:         2,
+					StandardSchedulerSettings: &appengine.StandardSchedulerSettings{TargetCpuUtilization: 0.6},
+				},
+				Handlers: []*appengine.UrlMap{{UrlRegex: "/.*", Login: "LOGIN_OPTIONAL", SecurityLevel: "SECURE_OPTIONAL"}},
+			},
+			desired: &appengine.Version{
+				Runtime:          "go114",
+				AutomaticScaling: &appengine.AutomaticScaling{MaxTotalInstances: 2},
+				Handlers:         []*appengine.UrlMap{{UrlRegex: "/.*"}},
+			},
+			want: nil,
+		},
+		{
+			name: "removed instance class",
+			current: &appengine.Version{
+				Runtime:       "go114",
+				InstanceClass: "F2",
+			},
+			desired: &appengine.Version{
+				Runtime: "go114",
+			},
+			want: []fieldChange{
+				{Path: "instanceClass", Before: "F2"},
+			},
+		},
+		{
+			name: "removed handler",
+			current: &appengine.Version{
+				Handlers: []*appengine.UrlMap{
+					{UrlRegex: "/static", StaticFiles: &appengine.StaticFilesHandler{Path: "build/index.html"}},
+					{UrlRegex: "/.*", Login: "LOGIN_OPTIONAL", SecurityLevel: "SECURE_ALWAYS"},
+				},
+			},
+			desired: &appengine.Version{
+				Handlers: []*appengine.UrlMap{
+					{UrlRegex: "/static", StaticFiles: &appengine.StaticFilesHandler{Path: "build/index.html"}},
+				},
+			},
+			want: []fieldChange{
+				{Path: "handlers[1].securityLevel", Before: "SECURE_ALWAYS"},
+				{Path: "handlers[1].urlRegex", Before: "/.*"},
+			},
+		},
+		{
+			name: "handlers",
+			current: &appengine.Version{
+				Handlers: []*appengine.UrlMap{{UrlRegex: "/.*", SecurityLevel: "SECURE_ALWAYS"}},
+			},
+			desired: &appengine.Version{
+				Handlers: []*appengine.UrlMap{{UrlRegex: "/.*", SecurityLevel: "SECURE_OPTIONAL"}},
+			},
+			want: []fieldChange{
+				{Path: "handlers[0].securityLevel", Before: "SECURE_ALWAYS", After: "SECURE_OPTIONAL"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := diffVersions(tt.current, tt.desired)
+			if err != nil {
+				t.Fatalf("diffVersions() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diffVersions() got = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
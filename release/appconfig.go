@@ -0,0 +1,61 @@
+package release
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+// applyAppConfig applies the cron jobs and task queues once the traffic
+// reaches the released versions, each of them as its own status step. They
+// target defaultTarget unless they set their own.
+func (rm *ReleaseManager) applyAppConfig(
+	ctx context.Context,
+	st terminal.Status,
+	client appengineutil.Client,
+	project string,
+	defaultTarget string,
+) error {
+	if len(rm.config.CronJobs) == 0 && len(rm.config.Queues) == 0 {
+		return nil
+	}
+
+	st.Update("Fetching the App Engine application location")
+
+	app, err := client.GetApplication(ctx, project)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error fetching the App Engine application")
+		return err
+	}
+
+	region := appengineutil.LocationRegion(app.LocationId)
+
+	if len(rm.config.CronJobs) > 0 {
+		st.Update("Applying cron jobs on Cloud Scheduler")
+
+		err := applyCronJobs(ctx, project, region, defaultTarget, rm.config.CronJobs, rm.clientOptions...)
+		if err != nil {
+			st.Step(terminal.StatusError, "Error applying cron jobs")
+			return err
+		}
+
+		st.Step(terminal.StatusOK, "Cron jobs applied ("+strconv.Itoa(len(rm.config.CronJobs))+")")
+	}
+
+	if len(rm.config.Queues) > 0 {
+		st.Update("Applying task queues on Cloud Tasks")
+
+		err := applyQueues(ctx, project, region, defaultTarget, rm.config.Queues, rm.clientOptions...)
+		if err != nil {
+			st.Step(terminal.StatusError, "Error applying task queues")
+			return err
+		}
+
+		st.Step(terminal.StatusOK, "Task queues applied ("+strconv.Itoa(len(rm.config.Queues))+")")
+	}
+
+	return nil
+}
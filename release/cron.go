@@ -0,0 +1,113 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/api/cloudscheduler/v1"
+	"google.golang.org/api/option"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+type cronJob struct {
+	// Name: Id of the Cloud Scheduler job.
+	Name string `hcl:"name"`
+
+	// Description: Description of the job.
+	Description string `hcl:"description,optional"`
+
+	// URL: Relative URL requested on the target service, for example
+	// /tasks/summary.
+	URL string `hcl:"url"`
+
+	// Schedule: Schedule in the unix-cron format, for example "0 9 * * 1".
+	Schedule string `hcl:"schedule"`
+
+	// TimeZone: Time zone of the schedule, from the tz database. Defaults
+	// to UTC.
+	TimeZone string `hcl:"timezone,optional"`
+
+	// Target: Service the requests are sent to. Defaults to the released
+	// service, required when several services are released together.
+	Target string `hcl:"target,optional"`
+}
+
+type cronJobs []cronJob
+
+// validate checks the cron jobs configuration.
+func (c cronJobs) validate() error {
+	for _, j := range c {
+		if j.Name == "" || j.URL == "" || j.Schedule == "" {
+			return errors.New("Cron job name, url and schedule should not be empty")
+		}
+	}
+
+	return nil
+}
+
+// validateTargets checks that each job has a target when there is no
+// default one.
+func (c cronJobs) validateTargets(defaultTarget string) error {
+	for _, j := range c {
+		if j.Target == "" && defaultTarget == "" {
+			return fmt.Errorf("Cron job %q should set its target when several services are released", j.Name)
+		}
+	}
+
+	return nil
+}
+
+// applyCronJobs creates the cron jobs or updates the existing ones on Cloud
+// Scheduler, targeting defaultTarget unless they set their own. Jobs which
+// are not configured anymore are left untouched.
+func applyCronJobs(
+	ctx context.Context,
+	project string,
+	region string,
+	defaultTarget string,
+	jobs cronJobs,
+	opts ...option.ClientOption,
+) error {
+	schedulerService, err := cloudscheduler.NewService(ctx, opts...)
+	if err != nil {
+		return err
+	}
+
+	parent := "projects/" + project + "/locations/" + region
+
+	for _, j := range jobs {
+		target := j.Target
+		if target == "" {
+			target = defaultTarget
+		}
+
+		job := &cloudscheduler.Job{
+			Name:        parent + "/jobs/" + j.Name,
+			Description: j.Description,
+			Schedule:    j.Schedule,
+			TimeZone:    j.TimeZone,
+			AppEngineHttpTarget: &cloudscheduler.AppEngineHttpTarget{
+				AppEngineRouting: &cloudscheduler.AppEngineRouting{Service: target},
+				HttpMethod:       "GET",
+				RelativeUri:      j.URL,
+			},
+		}
+
+		_, err := schedulerService.Projects.Locations.Jobs.Patch(job.Name, job).Context(ctx).Do()
+		if err == nil {
+			continue
+		}
+
+		if err := appengineutil.APIError(err); !errors.Is(err, appengineutil.ErrNotFound) {
+			return err
+		}
+
+		if _, err := schedulerService.Projects.Locations.Jobs.Create(parent, job).Context(ctx).Do(); err != nil {
+			return appengineutil.APIError(err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+package release
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appenginetest"
+)
+
+func Test_applyCronJobs(t *testing.T) {
+	const parent = "projects/project/locations/europe-west1"
+
+	tests := []struct {
+		name        string
+		jobs        cronJobs
+		existing    cronJobs
+		wantTargets map[string]string
+	}{
+		{
+			name:        "created with the released service",
+			jobs:        cronJobs{{Name: "summary", URL: "/tasks/summary", Schedule: "0 9 * * *"}},
+			wantTargets: map[string]string{"summary": "api"},
+		},
+		{
+			name: "created with their own target",
+			jobs: cronJobs{
+				{Name: "summary", URL: "/tasks/summary", Schedule: "0 9 * * *"},
+				{Name: "cleanup", URL: "/tasks/cleanup", Schedule: "0 3 * * *", Target: "worker"},
+			},
+			wantTargets: map[string]string{"summary": "api", "cleanup": "worker"},
+		},
+		{
+			name:        "updated",
+			existing:    cronJobs{{Name: "summary", URL: "/tasks/summary", Schedule: "0 9 * * *", Target: "worker"}},
+			jobs:        cronJobs{{Name: "summary", URL: "/tasks/summary", Schedule: "0 10 * * *"}},
+			wantTargets: map[string]string{"summary": "api"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			fake := appenginetest.NewServer()
+			defer fake.Close()
+
+			if len(tt.existing) > 0 {
+				if err := applyCronJobs(ctx, "project", "europe-west1", "", tt.existing, fake.ClientOptions()...); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := applyCronJobs(ctx, "project", "europe-west1", "api", tt.jobs, fake.ClientOptions()...); err != nil {
+				t.Fatalf("applyCronJobs() error = %v", err)
+			}
+
+			for _, j := range tt.jobs {
+				job := fake.Job(parent + "/jobs/" + j.Name)
+				if job == nil {
+					t.Fatalf("applyCronJobs() job %q not created", j.Name)
+				}
+
+				if got := job.AppEngineHttpTarget.AppEngineRouting.Service; got != tt.wantTargets[j.Name] {
+					t.Errorf("applyCronJobs() target of %q = %q, want %q", j.Name, got, tt.wantTargets[j.Name])
+				}
+
+				if job.Schedule != j.Schedule || job.AppEngineHttpTarget.RelativeUri != j.URL {
+					t.Errorf("applyCronJobs() job = %+v, want %+v", job, j)
+				}
+			}
+		})
+	}
+}
+
+func Test_cronJobs_validateTargets(t *testing.T) {
+	jobs := cronJobs{
+		{Name: "summary", URL: "/tasks/summary", Schedule: "0 9 * * *", Target: "api"},
+		{Name: "cleanup", URL: "/tasks/cleanup", Schedule: "0 3 * * *"},
+	}
+
+	if err := jobs.validateTargets("api"); err != nil {
+		t.Errorf("validateTargets() error = %v", err)
+	}
+
+	if err := jobs.validateTargets(""); err == nil {
+		t.Errorf("validateTargets() of a job without target and without default target should fail")
+	}
+}
@@ -0,0 +1,143 @@
+package release
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+type dispatchRule struct {
+	// Domain: Domain name to match against. The wildcard "*" is supported
+	// if specified before a period: "*.". Defaults to matching all domains.
+	Domain string `hcl:"domain,optional"`
+
+	// Path: Pathname within the host. Must start with a "/". A single "*"
+	// can be included at the end of the path.
+	Path string `hcl:"path"`
+
+	// Service: Resource ID of a service in this application that should
+	// serve the matched request.
+	Service string `hcl:"service"`
+}
+
+type dispatchRules []dispatchRule
+
+// validate checks the dispatch rules configuration.
+func (d dispatchRules) validate() error {
+	for _, r := range d {
+		if r.Path == "" || r.Path[0] != '/' {
+			return errors.New(`Dispatch rule path should start with a "/"`)
+		}
+
+		if r.Service == "" {
+			return errors.New("Dispatch rule service should not be empty")
+		}
+	}
+
+	return nil
+}
+
+// toAE converts data to the format expected by the appengine client.
+func (d dispatchRules) toAE() []*appengine.UrlDispatchRule {
+	rules := make([]*appengine.UrlDispatchRule, len(d))
+
+	for i, r := range d {
+		domain := r.Domain
+		if domain == "" {
+			domain = "*"
+		}
+
+		rules[i] = &appengine.UrlDispatchRule{Domain: domain, Path: r.Path, Service: r.Service}
+	}
+
+	return rules
+}
+
+// applyDispatchRules replaces the dispatch rules of the application with the
+// configured ones. Nothing is updated if the rules did not change.
+func applyDispatchRules(
+	ctx context.Context,
+	st terminal.Status,
+	client appengineutil.Client,
+	project string,
+	rules []*appengine.UrlDispatchRule,
+) error {
+	st.Update("Checking App Engine dispatch rules")
+
+	app, err := client.GetApplication(ctx, project)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error fetching the App Engine application")
+		return err
+	}
+
+	added, removed := diffDispatchRules(app.DispatchRules, rules)
+	if len(added) == 0 && len(removed) == 0 {
+		st.Step(terminal.StatusOK, "Dispatch rules are up to date")
+		return nil
+	}
+
+	for _, r := range removed {
+		st.Step(terminal.StatusWarn, "Removing dispatch rule '"+dispatchRuleString(r)+"'")
+	}
+
+	for _, r := range added {
+		st.Step(terminal.StatusOK, "Adding dispatch rule '"+dispatchRuleString(r)+"'")
+	}
+
+	st.Update("Updating App Engine dispatch rules")
+
+	op, err := client.PatchApplication(ctx, project, &appengine.Application{
+		DispatchRules:   rules,
+		ForceSendFields: []string{"DispatchRules"},
+	}, "dispatch_rules")
+	if err != nil {
+		st.Step(terminal.StatusError, "Error updating the dispatch rules")
+		return err
+	}
+
+	op, err = appengineutil.WaitForOperation(ctx, client, op)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error fetching the dispatch rules update status")
+		return err
+	}
+
+	if err := appengineutil.OperationError(op); err != nil {
+		st.Step(terminal.StatusError, "Error updating the dispatch rules")
+		return err
+	}
+
+	st.Step(terminal.StatusOK, "Dispatch rules updated")
+
+	return nil
+}
+
+// diffDispatchRules returns the desired rules missing from current and the
+// current rules missing from desired. Rules are matched in order, so a rule
+// that moved is both removed and added.
+func diffDispatchRules(current, desired []*appengine.UrlDispatchRule) (added, removed []*appengine.UrlDispatchRule) {
+	for i, r := range desired {
+		if i >= len(current) || !dispatchRuleEqual(current[i], r) {
+			added = append(added, r)
+		}
+	}
+
+	for i, r := range current {
+		if i >= len(desired) || !dispatchRuleEqual(desired[i], r) {
+			removed = append(removed, r)
+		}
+	}
+
+	return added, removed
+}
+
+func dispatchRuleEqual(a, b *appengine.UrlDispatchRule) bool {
+	return a.Domain == b.Domain && a.Path == b.Path && a.Service == b.Service
+}
+
+func dispatchRuleString(r *appengine.UrlDispatchRule) string {
+	return r.Domain + r.Path + " -> " + r.Service
+}
@@ -0,0 +1,61 @@
+package release
+
+import (
+	"reflect"
+	"testing"
+
+	"google.golang.org/api/appengine/v1"
+)
+
+func Test_diffDispatchRules(t *testing.T) {
+	api := &appengine.UrlDispatchRule{Domain: "*", Path: "/api/*", Service: "api"}
+	static := &appengine.UrlDispatchRule{Domain: "*", Path: "/static/*", Service: "static"}
+	admin := &appengine.UrlDispatchRule{Domain: "admin.example.com", Path: "/*", Service: "admin"}
+
+	tests := []struct {
+		name        string
+		current     []*appengine.UrlDispatchRule
+		desired     []*appengine.UrlDispatchRule
+		wantAdded   []*appengine.UrlDispatchRule
+		wantRemoved []*appengine.UrlDispatchRule
+	}{
+		{
+			name:    "unchanged",
+			current: []*appengine.UrlDispatchRule{api, static},
+			desired: []*appengine.UrlDispatchRule{{Domain: "*", Path: "/api/*", Service: "api"}, static},
+		},
+		{
+			name:      "added",
+			current:   []*appengine.UrlDispatchRule{api},
+			desired:   []*appengine.UrlDispatchRule{api, admin},
+			wantAdded: []*appengine.UrlDispatchRule{admin},
+		},
+		{
+			name:        "removed",
+			current:     []*appengine.UrlDispatchRule{api, static},
+			desired:     []*appengine.UrlDispatchRule{api},
+			wantRemoved: []*appengine.UrlDispatchRule{static},
+		},
+		{
+			name:        "reordered",
+			current:     []*appengine.UrlDispatchRule{api, static},
+			desired:     []*appengine.UrlDispatchRule{static, api},
+			wantAdded:   []*appengine.UrlDispatchRule{static, api},
+			wantRemoved: []*appengine.UrlDispatchRule{api, static},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed := diffDispatchRules(tt.current, tt.desired)
+
+			if !reflect.DeepEqual(added, tt.wantAdded) {
+				t.Errorf("diffDispatchRules() added = %v, want %v", added, tt.wantAdded)
+			}
+
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("diffDispatchRules() removed = %v, want %v", removed, tt.wantRemoved)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+const (
+	// sslManaged provisions and renews a certificate for the domain.
+	sslManaged = "managed"
+	// sslNone serves the domain without SSL. It never removes a managed
+	// certificate from an existing mapping.
+	sslNone = "none"
+)
+
+type domain struct {
+	// Name: Domain mapped to the application, for example api.example.com.
+	// The domain must be verified by the caller.
+	Name string `hcl:"name"`
+
+	// SSL: Either "managed" for a certificate managed by App Engine or
+	// "none" to map the domain without a certificate. A mapping which
+	// already has a managed certificate is not switched to "none".
+	// Defaults to "managed".
+	SSL string `hcl:"ssl,optional"`
+}
+
+type domains []domain
+
+// validate checks the domains configuration.
+func (d domains) validate() error {
+	for _, dm := range d {
+		if dm.Name == "" {
+			return errors.New("Domain name should not be empty")
+		}
+
+		switch dm.SSL {
+		case "", sslManaged, sslNone:
+		default:
+			return errors.New(`Domain ssl should be either "managed" or "none"`)
+		}
+	}
+
+	return nil
+}
+
+// sslManagementType returns the SslManagementType matching the ssl option.
+func (dm domain) sslManagementType() string {
+	if dm.SSL == sslNone {
+		return "MANUAL"
+	}
+
+	return "AUTOMATIC"
+}
+
+// mapDomain makes sure the domain is mapped to the application with the
+// configured SSL settings, and prints the DNS records to configure.
+func mapDomain(
+	ctx context.Context,
+	st terminal.Status,
+	client appengineutil.Client,
+	project string,
+	dm domain,
+) error {
+	st.Update("Checking domain mapping '" + dm.Name + "'")
+
+	sslManagementType := dm.sslManagementType()
+
+	mapping, err := client.GetDomainMapping(ctx, project, dm.Name)
+	if err != nil {
+		if !errors.Is(err, appengineutil.ErrNotFound) {
+			st.Step(terminal.StatusError, "Error fetching domain mapping '"+dm.Name+"'")
+			return err
+		}
+
+		mapping = nil
+	}
+
+	var op *appengine.Operation
+
+	switch {
+	case mapping == nil:
+		st.Update("Mapping domain '" + dm.Name + "'")
+
+		op, err = client.CreateDomainMapping(ctx, project, &appengine.DomainMapping{
+			Id:          dm.Name,
+			SslSettings: &appengine.SslSettings{SslManagementType: sslManagementType},
+		})
+	case mapping.SslSettings == nil || mapping.SslSettings.SslManagementType != sslManagementType:
+		// App Engine deletes the managed certificate when the mapping
+		// switches to manual SSL, the domain would stop serving HTTPS.
+		if mapping.SslSettings != nil && mapping.SslSettings.SslManagementType == "AUTOMATIC" {
+			st.Step(terminal.StatusError, "Domain '"+dm.Name+"' has a managed SSL certificate")
+			return fmt.Errorf(
+				"domain '%s' has a managed SSL certificate, ssl = %q would remove it: "+
+					"remove the certificate from the Cloud Console first",
+				dm.Name, sslNone,
+			)
+		}
+
+		st.Update("Updating domain mapping '" + dm.Name + "'")
+
+		op, err = client.PatchDomainMapping(ctx, project, dm.Name, &appengine.DomainMapping{
+			SslSettings: &appengine.SslSettings{SslManagementType: sslManagementType},
+		}, "ssl_settings.ssl_management_type")
+	}
+
+	if err != nil {
+		st.Step(terminal.StatusError, "Error mapping domain '"+dm.Name+"'")
+		return err
+	}
+
+	if op != nil {
+		op, err = appengineutil.WaitForOperation(ctx, client, op)
+		if err != nil {
+			st.Step(terminal.StatusError, "Error fetching the domain mapping status")
+			return err
+		}
+
+		if err := appengineutil.OperationError(op); err != nil {
+			st.Step(terminal.StatusError, "Error mapping domain '"+dm.Name+"'")
+			return err
+		}
+
+		mapping, err = client.GetDomainMapping(ctx, project, dm.Name)
+		if err != nil {
+			st.Step(terminal.StatusError, "Error fetching domain mapping '"+dm.Name+"'")
+			return err
+		}
+	}
+
+	st.Step(terminal.StatusOK, "Domain mapped '"+dm.Name+"'")
+
+	for _, rr := range mapping.ResourceRecords {
+		st.Step(terminal.StatusWarn, "Make sure this DNS record is configured: "+rr.Name+" "+rr.Type+" "+rr.Rrdata)
+	}
+
+	return nil
+}
@@ -0,0 +1,114 @@
+package release
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appenginetest"
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+func Test_mapDomain(t *testing.T) {
+	records := []*appengine.ResourceRecord{{Name: "api", Type: "CNAME", Rrdata: "ghs.googlehosted.com."}}
+
+	tests := []struct {
+		name      string
+		ssl       string
+		existing  *appengine.DomainMapping
+		wantErr   bool
+		wantCalls []string
+		wantSSL   string
+		wantMask  string
+	}{
+		{
+			name:      "created",
+			wantCalls: []string{"GetDomainMapping", "CreateDomainMapping", "GetDomainMapping"},
+			wantSSL:   "AUTOMATIC",
+		},
+		{
+			name:      "created without SSL",
+			ssl:       sslNone,
+			wantCalls: []string{"GetDomainMapping", "CreateDomainMapping", "GetDomainMapping"},
+			wantSSL:   "MANUAL",
+		},
+		{
+			name:      "SSL type patched",
+			existing:  &appengine.DomainMapping{Id: "api.example.com", SslSettings: &appengine.SslSettings{SslManagementType: "MANUAL"}},
+			wantCalls: []string{"GetDomainMapping", "PatchDomainMapping", "GetDomainMapping"},
+			wantSSL:   "AUTOMATIC",
+			wantMask:  "ssl_settings.ssl_management_type",
+		},
+		{
+			name:      "unchanged",
+			existing:  &appengine.DomainMapping{Id: "api.example.com", SslSettings: &appengine.SslSettings{SslManagementType: "AUTOMATIC"}},
+			wantCalls: []string{"GetDomainMapping"},
+		},
+		{
+			name:      "managed certificate kept",
+			ssl:       sslNone,
+			existing:  &appengine.DomainMapping{Id: "api.example.com", SslSettings: &appengine.SslSettings{SslManagementType: "AUTOMATIC"}},
+			wantErr:   true,
+			wantCalls: []string{"GetDomainMapping"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			var (
+				gotSSL  string
+				gotMask string
+				created bool
+			)
+
+			client := &appenginetest.MockClient{
+				GetDomainMappingFunc: func(project, domain string) (*appengine.DomainMapping, error) {
+					switch {
+					case created:
+						return &appengine.DomainMapping{Id: domain, ResourceRecords: records}, nil
+					case tt.existing != nil:
+						return tt.existing, nil
+					default:
+						return nil, &appengineutil.Error{Kind: appengineutil.NotFound, Message: "Domain mapping not found"}
+					}
+				},
+				CreateDomainMappingFunc: func(project string, m *appengine.DomainMapping) (*appengine.Operation, error) {
+					if m.Id != "api.example.com" {
+						t.Errorf("CreateDomainMapping() id = %q", m.Id)
+					}
+
+					created = true
+					gotSSL = m.SslSettings.SslManagementType
+
+					return appenginetest.DoneOperation(project), nil
+				},
+				PatchDomainMappingFunc: func(project, domain string, m *appengine.DomainMapping, updateMask string) (*appengine.Operation, error) {
+					gotSSL = m.SslSettings.SslManagementType
+					gotMask = updateMask
+
+					return appenginetest.DoneOperation(project), nil
+				},
+			}
+
+			st := terminal.NonInteractiveUI(ctx).Status()
+			defer st.Close()
+
+			err := mapDomain(ctx, st, client, "project", domain{Name: "api.example.com", SSL: tt.ssl})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("mapDomain() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(client.Calls, tt.wantCalls) {
+				t.Errorf("mapDomain() calls = %v, want %v", client.Calls, tt.wantCalls)
+			}
+
+			if gotSSL != tt.wantSSL || gotMask != tt.wantMask {
+				t.Errorf("mapDomain() SSL = %q, mask %q, want %q, mask %q", gotSSL, gotMask, tt.wantSSL, tt.wantMask)
+			}
+		})
+	}
+}
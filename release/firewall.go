@@ -0,0 +1,197 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+// defaultFirewallRulePriority is the priority of the default firewall rule,
+// which matches all the requests no other rule matched.
+const defaultFirewallRulePriority = 2147483647
+
+type firewallRule struct {
+	// Priority: A positive integer between 1 and 2147483646 defining the
+	// order of rule evaluation, rules with lower priorities are evaluated
+	// first. 2147483647 configures the default rule.
+	Priority int64 `hcl:"priority"`
+
+	// Action: The action to take on matched requests, either "ALLOW" or
+	// "DENY".
+	Action string `hcl:"action"`
+
+	// SourceRange: IP address or range, defined using CIDR notation, of
+	// requests that this rule applies to. "*" matches all IPs.
+	SourceRange string `hcl:"source_range"`
+
+	// Description: An optional string description of this rule.
+	Description string `hcl:"description,optional"`
+}
+
+type firewallRules []firewallRule
+
+// validate checks the firewall rules configuration.
+func (f firewallRules) validate() error {
+	priorities := make(map[int64]bool, len(f))
+
+	for _, r := range f {
+		if r.Priority < 1 || r.Priority > defaultFirewallRulePriority {
+			return fmt.Errorf("Firewall rule priority should be between 1 and %d", defaultFirewallRulePriority)
+		}
+
+		if priorities[r.Priority] {
+			return fmt.Errorf("Firewall rule priority %d is used more than once", r.Priority)
+		}
+
+		priorities[r.Priority] = true
+
+		switch strings.ToUpper(r.Action) {
+		case "ALLOW", "DENY":
+		default:
+			return errors.New(`Firewall rule action should be either "ALLOW" or "DENY"`)
+		}
+
+		if r.SourceRange == "" {
+			return errors.New("Firewall rule source range should not be empty")
+		}
+	}
+
+	return nil
+}
+
+// toAE converts data to the format expected by the appengine client, sorted
+// by priority.
+func (f firewallRules) toAE() []*appengine.FirewallRule {
+	rules := make([]*appengine.FirewallRule, len(f))
+
+	for i, r := range f {
+		rules[i] = &appengine.FirewallRule{
+			Action:      strings.ToUpper(r.Action),
+			Description: r.Description,
+			Priority:    r.Priority,
+			SourceRange: r.SourceRange,
+		}
+	}
+
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Priority < rules[j].Priority })
+
+	return rules
+}
+
+// syncFirewallRules replaces the firewall ingress rules of the application
+// with the configured ones. The differences are printed before they are
+// applied and nothing is updated if the rules did not change.
+func syncFirewallRules(
+	ctx context.Context,
+	st terminal.Status,
+	client appengineutil.Client,
+	project string,
+	rules []*appengine.FirewallRule,
+) error {
+	st.Update("Checking App Engine firewall rules")
+
+	current, err := client.ListIngressRules(ctx, project)
+	if err != nil {
+		st.Step(terminal.StatusError, "Error listing the App Engine firewall rules")
+		return err
+	}
+
+	rules = withDefaultFirewallRule(rules, current)
+
+	added, removed, changed := diffFirewallRules(current, rules)
+	if len(added) == 0 && len(removed) == 0 && len(changed) == 0 {
+		st.Step(terminal.StatusOK, "Firewall rules are up to date")
+		return nil
+	}
+
+	for _, r := range removed {
+		st.Step(terminal.StatusWarn, "Removing firewall rule "+firewallRuleString(r))
+	}
+
+	for _, r := range changed {
+		st.Step(terminal.StatusWarn, "Updating firewall rule "+firewallRuleString(r))
+	}
+
+	for _, r := range added {
+		st.Step(terminal.StatusOK, "Adding firewall rule "+firewallRuleString(r))
+	}
+
+	st.Update("Updating App Engine firewall rules")
+
+	if err := client.BatchUpdateIngressRules(ctx, project, rules); err != nil {
+		st.Step(terminal.StatusError, "Error updating the firewall rules")
+		return err
+	}
+
+	st.Step(terminal.StatusOK, "Firewall rules updated")
+
+	return nil
+}
+
+// withDefaultFirewallRule makes sure the rules end with a default rule.
+// If none is configured, the current default rule is kept, or requests are
+// allowed if there is none.
+func withDefaultFirewallRule(rules, current []*appengine.FirewallRule) []*appengine.FirewallRule {
+	for _, r := range rules {
+		if r.Priority == defaultFirewallRulePriority {
+			return rules
+		}
+	}
+
+	def := &appengine.FirewallRule{
+		Action:      "ALLOW",
+		Description: "The default action.",
+		Priority:    defaultFirewallRulePriority,
+		SourceRange: "*",
+	}
+
+	for _, r := range current {
+		if r.Priority == defaultFirewallRulePriority {
+			def = r
+		}
+	}
+
+	return append(rules, def)
+}
+
+// diffFirewallRules compares the rules by priority.
+func diffFirewallRules(current, desired []*appengine.FirewallRule) (added, removed, changed []*appengine.FirewallRule) {
+	byPriority := make(map[int64]*appengine.FirewallRule, len(current))
+	for _, r := range current {
+		byPriority[r.Priority] = r
+	}
+
+	desiredPriorities := make(map[int64]bool, len(desired))
+
+	for _, r := range desired {
+		desiredPriorities[r.Priority] = true
+
+		c, ok := byPriority[r.Priority]
+		switch {
+		case !ok:
+			added = append(added, r)
+		case c.Action != r.Action || c.SourceRange != r.SourceRange || c.Description != r.Description:
+			changed = append(changed, r)
+		}
+	}
+
+	for _, r := range current {
+		if !desiredPriorities[r.Priority] {
+			removed = append(removed, r)
+		}
+	}
+
+	return added, removed, changed
+}
+
+func firewallRuleString(r *appengine.FirewallRule) string {
+	return strconv.FormatInt(r.Priority, 10) + ": " + r.Action + " " + r.SourceRange
+}
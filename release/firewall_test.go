@@ -0,0 +1,148 @@
+package release
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appenginetest"
+)
+
+func Test_diffFirewallRules(t *testing.T) {
+	office := &appengine.FirewallRule{Priority: 100, Action: "ALLOW", SourceRange: "203.0.113.0/24", Description: "Office"}
+	vpn := &appengine.FirewallRule{Priority: 200, Action: "ALLOW", SourceRange: "198.51.100.7"}
+	deny := &appengine.FirewallRule{Priority: defaultFirewallRulePriority, Action: "DENY", SourceRange: "*"}
+
+	tests := []struct {
+		name        string
+		current     []*appengine.FirewallRule
+		desired     []*appengine.FirewallRule
+		wantAdded   []*appengine.FirewallRule
+		wantRemoved []*appengine.FirewallRule
+		wantChanged []*appengine.FirewallRule
+	}{
+		{
+			name:    "unchanged",
+			current: []*appengine.FirewallRule{office, deny},
+			desired: []*appengine.FirewallRule{office, deny},
+		},
+		{
+			name:      "added",
+			current:   []*appengine.FirewallRule{office, deny},
+			desired:   []*appengine.FirewallRule{office, vpn, deny},
+			wantAdded: []*appengine.FirewallRule{vpn},
+		},
+		{
+			name:        "removed",
+			current:     []*appengine.FirewallRule{office, vpn, deny},
+			desired:     []*appengine.FirewallRule{office, deny},
+			wantRemoved: []*appengine.FirewallRule{vpn},
+		},
+		{
+			name:        "changed",
+			current:     []*appengine.FirewallRule{office, deny},
+			desired:     []*appengine.FirewallRule{{Priority: 100, Action: "DENY", SourceRange: "203.0.113.0/24"}, deny},
+			wantChanged: []*appengine.FirewallRule{{Priority: 100, Action: "DENY", SourceRange: "203.0.113.0/24"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			added, removed, changed := diffFirewallRules(tt.current, tt.desired)
+
+			if !reflect.DeepEqual(added, tt.wantAdded) {
+				t.Errorf("diffFirewallRules() added = %v, want %v", added, tt.wantAdded)
+			}
+
+			if !reflect.DeepEqual(removed, tt.wantRemoved) {
+				t.Errorf("diffFirewallRules() removed = %v, want %v", removed, tt.wantRemoved)
+			}
+
+			if !reflect.DeepEqual(changed, tt.wantChanged) {
+				t.Errorf("diffFirewallRules() changed = %v, want %v", changed, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func Test_withDefaultFirewallRule(t *testing.T) {
+	office := &appengine.FirewallRule{Priority: 100, Action: "ALLOW", SourceRange: "203.0.113.0/24"}
+	deny := &appengine.FirewallRule{Priority: defaultFirewallRulePriority, Action: "DENY", SourceRange: "*"}
+
+	got := withDefaultFirewallRule([]*appengine.FirewallRule{office}, []*appengine.FirewallRule{deny})
+	if want := []*appengine.FirewallRule{office, deny}; !reflect.DeepEqual(got, want) {
+		t.Errorf("withDefaultFirewallRule() = %v, want %v", got, want)
+	}
+
+	got = withDefaultFirewallRule([]*appengine.FirewallRule{office}, nil)
+	if len(got) != 2 || got[1].Priority != defaultFirewallRulePriority || got[1].Action != "ALLOW" {
+		t.Errorf("withDefaultFirewallRule() = %v, want an allow all default rule", got)
+	}
+
+	got = withDefaultFirewallRule([]*appengine.FirewallRule{office, deny}, nil)
+	if want := []*appengine.FirewallRule{office, deny}; !reflect.DeepEqual(got, want) {
+		t.Errorf("withDefaultFirewallRule() = %v, want %v", got, want)
+	}
+}
+
+func Test_syncFirewallRules(t *testing.T) {
+	office := &appengine.FirewallRule{Priority: 100, Action: "ALLOW", SourceRange: "203.0.113.0/24"}
+	deny := &appengine.FirewallRule{Priority: defaultFirewallRulePriority, Action: "DENY", SourceRange: "*"}
+
+	tests := []struct {
+		name      string
+		current   []*appengine.FirewallRule
+		rules     []*appengine.FirewallRule
+		wantCalls []string
+		wantRules []*appengine.FirewallRule
+	}{
+		{
+			name:      "up to date",
+			current:   []*appengine.FirewallRule{office, deny},
+			rules:     []*appengine.FirewallRule{office},
+			wantCalls: []string{"ListIngressRules"},
+		},
+		{
+			name:      "rule added",
+			current:   []*appengine.FirewallRule{deny},
+			rules:     []*appengine.FirewallRule{office},
+			wantCalls: []string{"ListIngressRules", "BatchUpdateIngressRules"},
+			wantRules: []*appengine.FirewallRule{office, deny},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			var gotRules []*appengine.FirewallRule
+
+			client := &appenginetest.MockClient{
+				ListIngressRulesFunc: func(project string) ([]*appengine.FirewallRule, error) {
+					return tt.current, nil
+				},
+				BatchUpdateIngressRulesFunc: func(project string, rules []*appengine.FirewallRule) error {
+					gotRules = rules
+					return nil
+				},
+			}
+
+			st := terminal.NonInteractiveUI(ctx).Status()
+			defer st.Close()
+
+			if err := syncFirewallRules(ctx, st, client, "project", tt.rules); err != nil {
+				t.Fatalf("syncFirewallRules() error = %v", err)
+			}
+
+			if !reflect.DeepEqual(client.Calls, tt.wantCalls) {
+				t.Errorf("syncFirewallRules() calls = %v, want %v", client.Calls, tt.wantCalls)
+			}
+
+			if !reflect.DeepEqual(gotRules, tt.wantRules) {
+				t.Errorf("syncFirewallRules() rules = %v, want %v", gotRules, tt.wantRules)
+			}
+		})
+	}
+}
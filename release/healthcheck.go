@@ -0,0 +1,139 @@
+package release
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHealthCheckExpectedStatus = http.StatusOK
+	defaultHealthCheckTimeout        = 10 * time.Second
+	defaultHealthCheckAttempts       = 3
+
+	// healthCheckInterval is the time waited between two failed attempts.
+	healthCheckInterval = 5 * time.Second
+)
+
+type healthCheck struct {
+	// Path: Path probed on the version. Defaults to "/".
+	Path string `hcl:"path,optional"`
+
+	// ExpectedStatus: HTTP status the version should respond with.
+	// Defaults to 200.
+	ExpectedStatus int `hcl:"expected_status,optional"`
+
+	// Timeout: Timeout of each attempt, as a duration string such as
+	// "10s". Defaults to 10s.
+	Timeout string `hcl:"timeout,optional"`
+
+	// Attempts: Number of attempts before the version is considered
+	// unhealthy. Defaults to 3.
+	Attempts int `hcl:"attempts,optional"`
+}
+
+// validate checks the health check configuration.
+func (hc *healthCheck) validate() error {
+	if hc == nil {
+		return nil
+	}
+
+	if hc.Timeout != "" {
+		if _, err := time.ParseDuration(hc.Timeout); err != nil {
+			return fmt.Errorf("Invalid health check timeout: %s", err)
+		}
+	}
+
+	if hc.Attempts < 0 {
+		return fmt.Errorf("Health check attempts should not be negative")
+	}
+
+	return nil
+}
+
+// versionURL returns the URL targeting a specific version of a service.
+// defaultHostname is the default hostname of the App Engine application,
+// for example project-id.uc.r.appspot.com.
+func versionURL(versionID, service, defaultHostname, path string) string {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+
+	return "https://" + versionID + "-dot-" + service + "-dot-" + defaultHostname + path
+}
+
+// probe requests the URL until it responds with the expected status or the
+// attempts are exhausted.
+func (hc *healthCheck) probe(
+	ctx context.Context,
+	client *http.Client,
+	url string,
+	interval time.Duration,
+) error {
+	expectedStatus := hc.ExpectedStatus
+	if expectedStatus == 0 {
+		expectedStatus = defaultHealthCheckExpectedStatus
+	}
+
+	timeout := defaultHealthCheckTimeout
+	if hc.Timeout != "" {
+		timeout, _ = time.ParseDuration(hc.Timeout)
+	}
+
+	attempts := hc.Attempts
+	if attempts == 0 {
+		attempts = defaultHealthCheckAttempts
+	}
+
+	var err error
+
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(interval):
+			}
+		}
+
+		if err = probeOnce(ctx, client, url, timeout, expectedStatus); err == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("health check failed after %d attempts: %w", attempts, err)
+}
+
+func probeOnce(
+	ctx context.Context,
+	client *http.Client,
+	url string,
+	timeout time.Duration,
+	expectedStatus int,
+) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode != expectedStatus {
+		return fmt.Errorf("%s responded with status %d, expected %d", url, resp.StatusCode, expectedStatus)
+	}
+
+	return nil
+}
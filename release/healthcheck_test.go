@@ -0,0 +1,92 @@
+package release
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func Test_healthCheck_probe(t *testing.T) {
+	tests := []struct {
+		name string
+		hc   healthCheck
+		// statuses are the statuses returned by the server for each request,
+		// the last one is repeated.
+		statuses  []int
+		delay     time.Duration
+		wantCalls int32
+		wantErr   bool
+	}{
+		{
+			name:      "healthy",
+			hc:        healthCheck{},
+			statuses:  []int{http.StatusOK},
+			wantCalls: 1,
+		},
+		{
+			name:      "healthy after retries",
+			hc:        healthCheck{Attempts: 3},
+			statuses:  []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK},
+			wantCalls: 3,
+		},
+		{
+			name:      "unexpected status",
+			hc:        healthCheck{Attempts: 2},
+			statuses:  []int{http.StatusInternalServerError},
+			wantCalls: 2,
+			wantErr:   true,
+		},
+		{
+			name:      "expected status",
+			hc:        healthCheck{ExpectedStatus: http.StatusNoContent},
+			statuses:  []int{http.StatusNoContent},
+			wantCalls: 1,
+		},
+		{
+			name:      "timeout",
+			hc:        healthCheck{Timeout: "10ms", Attempts: 1},
+			statuses:  []int{http.StatusOK},
+			delay:     100 * time.Millisecond,
+			wantCalls: 1,
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := int(atomic.AddInt32(&calls, 1)) - 1
+				if i >= len(tt.statuses) {
+					i = len(tt.statuses) - 1
+				}
+
+				time.Sleep(tt.delay)
+				w.WriteHeader(tt.statuses[i])
+			}))
+			defer srv.Close()
+
+			err := tt.hc.probe(context.Background(), srv.Client(), srv.URL+"/healthz", time.Millisecond)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("probe() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := atomic.LoadInt32(&calls); got != tt.wantCalls {
+				t.Errorf("probe() calls = %v, want %v", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func Test_versionURL(t *testing.T) {
+	got := versionURL("20201021t120000", "api", "project-id.uc.r.appspot.com", "healthz")
+	want := "https://20201021t120000-dot-api-dot-project-id.uc.r.appspot.com/healthz"
+
+	if got != want {
+		t.Errorf("versionURL() = %v, want %v", got, want)
+	}
+}
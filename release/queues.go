@@ -0,0 +1,114 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"google.golang.org/api/cloudtasks/v2"
+	"google.golang.org/api/option"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+type queue struct {
+	// Name: Id of the Cloud Tasks queue.
+	Name string `hcl:"name"`
+
+	// MaxDispatchesPerSecond: Maximum rate at which tasks are dispatched.
+	MaxDispatchesPerSecond float64 `hcl:"max_dispatches_per_second,optional"`
+
+	// MaxConcurrentDispatches: Maximum number of tasks dispatched
+	// concurrently.
+	MaxConcurrentDispatches int64 `hcl:"max_concurrent_dispatches,optional"`
+
+	// MaxAttempts: Number of attempts per task, -1 for unlimited attempts.
+	MaxAttempts int64 `hcl:"max_attempts,optional"`
+
+	// Target: Service the tasks are sent to, overriding the service of the
+	// tasks. Defaults to the released service, required when several
+	// services are released together.
+	Target string `hcl:"target,optional"`
+}
+
+type queues []queue
+
+// validate checks the queues configuration.
+func (q queues) validate() error {
+	for _, qu := range q {
+		if qu.Name == "" {
+			return errors.New("Queue name should not be empty")
+		}
+	}
+
+	return nil
+}
+
+// validateTargets checks that each queue has a target when there is no
+// default one.
+func (q queues) validateTargets(defaultTarget string) error {
+	for _, qu := range q {
+		if qu.Target == "" && defaultTarget == "" {
+			return fmt.Errorf("Queue %q should set its target when several services are released", qu.Name)
+		}
+	}
+
+	return nil
+}
+
+// applyQueues creates the queues or updates the existing ones on Cloud
+// Tasks, routing their tasks to defaultTarget unless they set their own
+// target. Queues which are not configured anymore are left untouched.
+func applyQueues(
+	ctx context.Context,
+	project string,
+	region string,
+	defaultTarget string,
+	qs queues,
+	opts ...option.ClientOption,
+) error {
+	tasksService, err := cloudtasks.NewService(ctx, opts...)
+	if err != nil {
+		return err
+	}
+
+	parent := "projects/" + project + "/locations/" + region
+
+	for _, qu := range qs {
+		target := qu.Target
+		if target == "" {
+			target = defaultTarget
+		}
+
+		q := &cloudtasks.Queue{
+			Name:                     parent + "/queues/" + qu.Name,
+			AppEngineRoutingOverride: &cloudtasks.AppEngineRouting{Service: target},
+		}
+
+		if qu.MaxDispatchesPerSecond != 0 || qu.MaxConcurrentDispatches != 0 {
+			q.RateLimits = &cloudtasks.RateLimits{
+				MaxConcurrentDispatches: qu.MaxConcurrentDispatches,
+				MaxDispatchesPerSecond:  qu.MaxDispatchesPerSecond,
+			}
+		}
+
+		if qu.MaxAttempts != 0 {
+			q.RetryConfig = &cloudtasks.RetryConfig{MaxAttempts: qu.MaxAttempts}
+		}
+
+		_, err := tasksService.Projects.Locations.Queues.Patch(q.Name, q).Context(ctx).Do()
+		if err == nil {
+			continue
+		}
+
+		if err := appengineutil.APIError(err); !errors.Is(err, appengineutil.ErrNotFound) {
+			return err
+		}
+
+		if _, err := tasksService.Projects.Locations.Queues.Create(parent, q).Context(ctx).Do(); err != nil {
+			return appengineutil.APIError(err)
+		}
+	}
+
+	return nil
+}
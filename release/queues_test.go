@@ -0,0 +1,85 @@
+package release
+
+import (
+	"context"
+	"testing"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appenginetest"
+)
+
+func Test_applyQueues(t *testing.T) {
+	const parent = "projects/project/locations/europe-west1"
+
+	tests := []struct {
+		name        string
+		queues      queues
+		existing    queues
+		wantTargets map[string]string
+	}{
+		{
+			name:        "created with the released service",
+			queues:      queues{{Name: "emails", MaxDispatchesPerSecond: 10}},
+			wantTargets: map[string]string{"emails": "api"},
+		},
+		{
+			name:        "created with their own target",
+			queues:      queues{{Name: "emails"}, {Name: "exports", Target: "worker", MaxAttempts: 5}},
+			wantTargets: map[string]string{"emails": "api", "exports": "worker"},
+		},
+		{
+			name:        "updated",
+			existing:    queues{{Name: "emails", Target: "worker"}},
+			queues:      queues{{Name: "emails", MaxConcurrentDispatches: 5}},
+			wantTargets: map[string]string{"emails": "api"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			fake := appenginetest.NewServer()
+			defer fake.Close()
+
+			if len(tt.existing) > 0 {
+				if err := applyQueues(ctx, "project", "europe-west1", "", tt.existing, fake.ClientOptions()...); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := applyQueues(ctx, "project", "europe-west1", "api", tt.queues, fake.ClientOptions()...); err != nil {
+				t.Fatalf("applyQueues() error = %v", err)
+			}
+
+			for _, qu := range tt.queues {
+				q := fake.Queue(parent + "/queues/" + qu.Name)
+				if q == nil {
+					t.Fatalf("applyQueues() queue %q not created", qu.Name)
+				}
+
+				if got := q.AppEngineRoutingOverride.Service; got != tt.wantTargets[qu.Name] {
+					t.Errorf("applyQueues() target of %q = %q, want %q", qu.Name, got, tt.wantTargets[qu.Name])
+				}
+
+				if (q.RateLimits != nil) != (qu.MaxDispatchesPerSecond != 0 || qu.MaxConcurrentDispatches != 0) {
+					t.Errorf("applyQueues() rate limits of %q = %+v", qu.Name, q.RateLimits)
+				}
+
+				if (q.RetryConfig != nil) != (qu.MaxAttempts != 0) {
+					t.Errorf("applyQueues() retry config of %q = %+v", qu.Name, q.RetryConfig)
+				}
+			}
+		})
+	}
+}
+
+func Test_queues_validateTargets(t *testing.T) {
+	qs := queues{{Name: "emails", Target: "api"}, {Name: "exports"}}
+
+	if err := qs.validateTargets("api"); err != nil {
+		t.Errorf("validateTargets() error = %v", err)
+	}
+
+	if err := qs.validateTargets(""); err == nil {
+		t.Errorf("validateTargets() of a queue without target and without default target should fail")
+	}
+}
@@ -2,20 +2,71 @@ package release
 
 import (
 	"context"
-	"errors"
 	"fmt"
+	"net/http"
 
+	"github.com/hashicorp/go-multierror"
 	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
 	"google.golang.org/api/appengine/v1"
+	"google.golang.org/api/option"
 
 	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
 	"github.com/sharkyze/waypoint-plugin-appengine/platform"
 )
 
-type ReleaseConfig struct{}
+type ReleaseConfig struct {
+	// HealthCheck: Probe the version before releasing it, the release is
+	// refused if the version does not respond as expected.
+	HealthCheck *healthCheck `hcl:"health_check,block"`
+
+	// DispatchRules: Rules routing requests to the services of the
+	// application by host and path. When set, they replace the dispatch
+	// rules of the application on each release.
+	DispatchRules dispatchRules `hcl:"dispatch_rule,block"`
+
+	// FirewallRules: Ingress rules of the application firewall. When set,
+	// they replace the firewall rules of the application on each release.
+	// The current default rule is kept unless one is configured with the
+	// priority 2147483647.
+	FirewallRules firewallRules `hcl:"firewall_rule,block"`
+
+	// Domains: Custom domains mapped to the application on each release.
+	Domains domains `hcl:"domain,block"`
+
+	// CronJobs: Cron jobs created on Cloud Scheduler once the traffic is
+	// moved, targeting the released service unless they set their own.
+	CronJobs cronJobs `hcl:"cron,block"`
+
+	// Queues: Task queues created on Cloud Tasks once the traffic is moved,
+	// routing their tasks to the released service unless they set their
+	// own target.
+	Queues queues `hcl:"queue,block"`
+}
 
 type ReleaseManager struct {
 	config ReleaseConfig
+
+	// clientOptions are passed to the Google API clients, tests use them
+	// to point the clients to a fake server.
+	clientOptions []option.ClientOption
+
+	// client is the App Engine client, created from the client options on
+	// first use unless set.
+	client appengineutil.Client
+}
+
+// appengineClient returns the App Engine client of the release manager.
+func (rm *ReleaseManager) appengineClient(ctx context.Context) (appengineutil.Client, error) {
+	if rm.client == nil {
+		client, err := appengineutil.NewClient(ctx, rm.clientOptions...)
+		if err != nil {
+			return nil, err
+		}
+
+		rm.client = client
+	}
+
+	return rm.client, nil
 }
 
 // Config implements component.Configurable.
@@ -25,13 +76,36 @@ func (rm *ReleaseManager) Config() (interface{}, error) {
 
 // ConfigSet implements component.ConfigurableNotify.
 func (rm *ReleaseManager) ConfigSet(config interface{}) error {
-	_, ok := config.(*ReleaseConfig)
+	c, ok := config.(*ReleaseConfig)
 	if !ok {
 		// The Waypoint SDK should ensure this never gets hit.
 		return fmt.Errorf("Expected *ReleaseConfig as parameter")
 	}
 
 	// validate the config
+	if err := c.HealthCheck.validate(); err != nil {
+		return err
+	}
+
+	if err := c.DispatchRules.validate(); err != nil {
+		return err
+	}
+
+	if err := c.FirewallRules.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Domains.validate(); err != nil {
+		return err
+	}
+
+	if err := c.CronJobs.validate(); err != nil {
+		return err
+	}
+
+	if err := c.Queues.validate(); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -78,38 +152,193 @@ func (rm *ReleaseManager) release(
 	defer st.Close()
 
 	project := deployment.Project
-	service := deployment.Service
-	versionID := deployment.VersionId
+	versions := deployment.ServiceVersions()
 
-	st.Update("Releasing App Engine version '" + versionID + "'")
-
-	appengineService, err := appengine.NewService(ctx)
+	client, err := rm.appengineClient(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	servicePatchCall := appengineService.Apps.Services.Patch(project, service, &appengine.Service{
-		Split: &appengine.TrafficSplit{Allocations: map[string]float64{versionID: 1}},
-	})
-	servicePatchCall.UpdateMask("split")
-	servicePatchCall = servicePatchCall.Context(ctx)
+	// The cron jobs and queues need a target of their own when several
+	// services are released, they are checked before any traffic is moved.
+	var defaultTarget string
+	if len(versions) == 1 {
+		defaultTarget = versions[0].Service
+	}
+
+	if err := rm.config.CronJobs.validateTargets(defaultTarget); err != nil {
+		st.Step(terminal.StatusError, "Invalid cron jobs configuration")
+		return nil, err
+	}
 
-	op, err := servicePatchCall.Do()
-	if err != nil {
+	if err := rm.config.Queues.validateTargets(defaultTarget); err != nil {
+		st.Step(terminal.StatusError, "Invalid task queues configuration")
 		return nil, err
 	}
 
-	op, err = appengineutil.WaitForOperation(ctx, appengineService, op)
-	if err != nil {
+	// All the versions are checked before any traffic is moved, so a
+	// service deployed together with the others is not released alone.
+	if hc := rm.config.HealthCheck; hc != nil {
+		app, err := client.GetApplication(ctx, project)
+		if err != nil {
+			st.Step(terminal.StatusError, "Error fetching the App Engine application")
+			return nil, err
+		}
+
+		for _, v := range versions {
+			u := versionURL(v.VersionId, v.Service, app.DefaultHostname, hc.Path)
+
+			st.Update("Checking version health '" + u + "'")
+
+			if err := hc.probe(ctx, http.DefaultClient, u, healthCheckInterval); err != nil {
+				st.Step(terminal.StatusError, "Version is not healthy, refusing to release it")
+				return nil, err
+			}
+
+			st.Step(terminal.StatusOK, "Version is healthy '"+u+"'")
+		}
+	}
+
+	if err := releaseVersions(ctx, st, client, project, versions); err != nil {
 		return nil, err
 	}
 
-	if op.Error != nil {
-		st.Step(terminal.StatusError, "Traffic split error")
-		return nil, errors.New(op.Error.Message)
+	if len(rm.config.DispatchRules) > 0 {
+		err := applyDispatchRules(ctx, st, client, project, rm.config.DispatchRules.toAE())
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(rm.config.FirewallRules) > 0 {
+		err := syncFirewallRules(ctx, st, client, project, rm.config.FirewallRules.toAE())
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	st.Step(terminal.StatusOK, "Traffic split successful")
+	if err := rm.applyAppConfig(ctx, st, client, project, defaultTarget); err != nil {
+		return nil, err
+	}
+
+	for _, dm := range rm.config.Domains {
+		if err := mapDomain(ctx, st, client, project, dm); err != nil {
+			return nil, err
+		}
+	}
+
+	released := make([]*Release_Version, len(versions))
+	for i, v := range versions {
+		released[i] = &Release_Version{Service: v.Service, VersionId: v.VersionId}
+	}
+
+	return &Release{Project: project, Versions: released}, nil
+}
+
+// releaseVersions moves all the traffic of each service to its version. The
+// services are released together: the split of each service is recorded
+// first and, if one of them cannot be updated, the splits already changed
+// are restored.
+func releaseVersions(
+	ctx context.Context,
+	st terminal.Status,
+	client appengineutil.Client,
+	project string,
+	versions []*platform.Deployment_Version,
+) error {
+	priorSplits := make([]*appengine.TrafficSplit, len(versions))
+
+	for i, v := range versions {
+		st.Update("Fetching the traffic split of service '" + v.Service + "'")
+
+		aes, err := client.GetService(ctx, project, v.Service)
+		if err != nil {
+			st.Step(terminal.StatusError, "Error fetching App Engine service '"+v.Service+"'")
+			return err
+		}
+
+		priorSplits[i] = aes.Split
+	}
+
+	for i, v := range versions {
+		split := &appengine.TrafficSplit{Allocations: map[string]float64{v.VersionId: 1}}
+
+		st.Update("Releasing App Engine version '" + v.VersionId + "' of service '" + v.Service + "'")
+
+		patched, err := patchSplit(ctx, client, project, v.Service, split)
+		if err == nil {
+			st.Step(terminal.StatusOK, "Traffic split successful '"+v.Service+"'")
+			continue
+		}
+
+		st.Step(terminal.StatusError, "Traffic split error '"+v.Service+"'")
+
+		// The split of the failed service is restored too when the update was
+		// accepted, its outcome is unknown.
+		n := i
+		if patched {
+			n++
+		}
+
+		if rerr := restoreSplits(ctx, st, client, project, versions[:n], priorSplits[:n]); rerr != nil {
+			return appengineutil.Annotate(err, "restoring the traffic splits: "+rerr.Error())
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// restoreSplits sets the splits of the services back to the recorded ones.
+func restoreSplits(
+	ctx context.Context,
+	st terminal.Status,
+	client appengineutil.Client,
+	project string,
+	versions []*platform.Deployment_Version,
+	splits []*appengine.TrafficSplit,
+) error {
+	var merr *multierror.Error
+
+	for i, v := range versions {
+		if splits[i] == nil {
+			continue
+		}
+
+		st.Update("Restoring the traffic split of service '" + v.Service + "'")
+
+		if _, err := patchSplit(ctx, client, project, v.Service, splits[i]); err != nil {
+			st.Step(terminal.StatusError, "Error restoring the traffic split of service '"+v.Service+"'")
+			merr = multierror.Append(merr, fmt.Errorf("restoring the traffic split of service '%s': %w", v.Service, err))
+
+			continue
+		}
+
+		st.Step(terminal.StatusWarn, "Traffic split of service '"+v.Service+"' restored")
+	}
+
+	return merr.ErrorOrNil()
+}
+
+// patchSplit updates the traffic split of the service and waits for the
+// update to complete. patched reports whether the update was accepted.
+func patchSplit(
+	ctx context.Context,
+	client appengineutil.Client,
+	project string,
+	service string,
+	split *appengine.TrafficSplit,
+) (patched bool, err error) {
+	op, err := client.PatchService(ctx, project, service, &appengine.Service{Split: split}, "split")
+	if err != nil {
+		return false, err
+	}
+
+	op, err = appengineutil.WaitForOperation(ctx, client, op)
+	if err != nil {
+		return true, err
+	}
 
-	return &Release{}, nil
+	return true, appengineutil.OperationError(op)
 }
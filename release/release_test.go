@@ -0,0 +1,237 @@
+package release
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appenginetest"
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+	"github.com/sharkyze/waypoint-plugin-appengine/platform"
+)
+
+func TestReleaseManager_release(t *testing.T) {
+	pollInterval := appengineutil.PollInterval
+	appengineutil.PollInterval = time.Millisecond
+
+	defer func() { appengineutil.PollInterval = pollInterval }()
+
+	tests := []struct {
+		name      string
+		versionID string
+		wantErr   bool
+		wantSplit map[string]float64
+	}{
+		{
+			name:      "new version",
+			versionID: "v2",
+			wantSplit: map[string]float64{"v2": 1},
+		},
+		{
+			name:      "serving version",
+			versionID: "v1",
+			wantSplit: map[string]float64{"v1": 1},
+		},
+		{
+			name:      "unknown version",
+			versionID: "v3",
+			wantErr:   true,
+			wantSplit: map[string]float64{"v1": 1},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			fake := appenginetest.NewServer()
+			defer fake.Close()
+
+			fake.OperationPolls = 3
+			fake.AddVersion("project", "api", &appengine.Version{Id: "v1", Runtime: "go114"})
+			fake.AddVersion("project", "api", &appengine.Version{Id: "v2", Runtime: "go114"})
+
+			rm := &ReleaseManager{clientOptions: fake.ClientOptions()}
+			d := &platform.Deployment{Project: "project", Service: "api", VersionId: tt.versionID}
+
+			_, err := rm.release(ctx, d, terminal.NonInteractiveUI(ctx))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("release() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := fake.Service("project", "api").Split.Allocations; !reflect.DeepEqual(got, tt.wantSplit) {
+				t.Errorf("release() split = %v, want %v", got, tt.wantSplit)
+			}
+		})
+	}
+}
+
+func TestReleaseManager_release_services(t *testing.T) {
+	pollInterval := appengineutil.PollInterval
+	appengineutil.PollInterval = time.Millisecond
+
+	defer func() { appengineutil.PollInterval = pollInterval }()
+
+	tests := []struct {
+		name       string
+		versions   []*platform.Deployment_Version
+		wantErr    bool
+		wantCode   codes.Code
+		wantSplits map[string]map[string]float64
+	}{
+		{
+			name: "released",
+			versions: []*platform.Deployment_Version{
+				{Service: "api", VersionId: "v2"},
+				{Service: "worker", VersionId: "v2"},
+			},
+			wantSplits: map[string]map[string]float64{
+				"api":    {"v2": 1},
+				"worker": {"v2": 1},
+			},
+		},
+		{
+			name: "rolled back",
+			versions: []*platform.Deployment_Version{
+				{Service: "api", VersionId: "v2"},
+				{Service: "worker", VersionId: "v3"},
+			},
+			wantErr:  true,
+			wantCode: codes.InvalidArgument,
+			wantSplits: map[string]map[string]float64{
+				"api":    {"v1": 1},
+				"worker": {"v1": 1},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			fake := appenginetest.NewServer()
+			defer fake.Close()
+
+			for _, service := range []string{"api", "worker"} {
+				fake.AddVersion("project", service, &appengine.Version{Id: "v1", Runtime: "go114"})
+				fake.AddVersion("project", service, &appengine.Version{Id: "v2", Runtime: "go114"})
+			}
+
+			rm := &ReleaseManager{clientOptions: fake.ClientOptions()}
+			d := &platform.Deployment{
+				Project:   "project",
+				Service:   tt.versions[0].Service,
+				VersionId: tt.versions[0].VersionId,
+				Versions:  tt.versions,
+			}
+
+			r, err := rm.release(ctx, d, terminal.NonInteractiveUI(ctx))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("release() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if got := status.Code(err); got != tt.wantCode {
+				t.Errorf("release() status code = %v, want %v", got, tt.wantCode)
+			}
+
+			if err == nil && (r.Project != "project" || len(r.Versions) != len(tt.versions)) {
+				t.Errorf("release() = %v, want the released versions of the project", r)
+			}
+
+			for service, want := range tt.wantSplits {
+				if got := fake.Service("project", service).Split.Allocations; !reflect.DeepEqual(got, want) {
+					t.Errorf("release() split of %q = %v, want %v", service, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReleaseManager_release_appConfig(t *testing.T) {
+	pollInterval := appengineutil.PollInterval
+	appengineutil.PollInterval = time.Millisecond
+
+	defer func() { appengineutil.PollInterval = pollInterval }()
+
+	const job = "projects/project/locations/us-central1/jobs/summary"
+
+	tests := []struct {
+		name       string
+		versions   []*platform.Deployment_Version
+		target     string
+		wantErr    bool
+		wantTarget string
+	}{
+		{
+			name:       "released service",
+			versions:   []*platform.Deployment_Version{{Service: "api", VersionId: "v2"}},
+			wantTarget: "api",
+		},
+		{
+			name: "several services with a target",
+			versions: []*platform.Deployment_Version{
+				{Service: "api", VersionId: "v2"},
+				{Service: "worker", VersionId: "v2"},
+			},
+			target:     "worker",
+			wantTarget: "worker",
+		},
+		{
+			name: "several services without a target",
+			versions: []*platform.Deployment_Version{
+				{Service: "api", VersionId: "v2"},
+				{Service: "worker", VersionId: "v2"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			fake := appenginetest.NewServer()
+			defer fake.Close()
+
+			for _, service := range []string{"api", "worker"} {
+				fake.AddVersion("project", service, &appengine.Version{Id: "v1", Runtime: "go114"})
+				fake.AddVersion("project", service, &appengine.Version{Id: "v2", Runtime: "go114"})
+			}
+
+			rm := &ReleaseManager{
+				config: ReleaseConfig{
+					CronJobs: cronJobs{{Name: "summary", URL: "/tasks/summary", Schedule: "0 9 * * *", Target: tt.target}},
+				},
+				clientOptions: fake.ClientOptions(),
+			}
+			d := &platform.Deployment{
+				Project:   "project",
+				Service:   tt.versions[0].Service,
+				VersionId: tt.versions[0].VersionId,
+				Versions:  tt.versions,
+			}
+
+			_, err := rm.release(ctx, d, terminal.NonInteractiveUI(ctx))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("release() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			if err != nil {
+				// The configuration is checked before any traffic is moved.
+				if got := fake.Service("project", "api").Split.Allocations; !reflect.DeepEqual(got, map[string]float64{"v1": 1}) {
+					t.Errorf("release() split = %v, want it unchanged", got)
+				}
+
+				return
+			}
+
+			j := fake.Job(job)
+			if j == nil || j.AppEngineHttpTarget.AppEngineRouting.Service != tt.wantTarget {
+				t.Errorf("release() job = %+v, want targeting %q", j, tt.wantTarget)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package release
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+
+	sdk "github.com/hashicorp/waypoint-plugin-sdk/proto/gen"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+// StatusFunc implements component.Status.
+func (rm *ReleaseManager) StatusFunc() interface{} {
+	return rm.status
+}
+
+// status reports whether the released versions still receive all the
+// traffic of their service. The traffic split can drift after a release,
+// for example when it is changed from the Cloud Console.
+func (rm *ReleaseManager) status(ctx context.Context, ui terminal.UI, release *Release) (*sdk.StatusReport, error) {
+	st := ui.Status()
+	defer st.Close()
+
+	client, err := rm.appengineClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]*sdk.StatusReport_Resource, len(release.Versions))
+
+	for i, v := range release.Versions {
+		st.Update("Checking the traffic split of service '" + v.Service + "'")
+
+		r, err := splitStatus(ctx, client, release.Project, v.Service, v.VersionId)
+		if err != nil {
+			st.Step(terminal.StatusError, "Error fetching App Engine service '"+v.Service+"'")
+			return nil, err
+		}
+
+		if r.Health != sdk.StatusReport_READY {
+			st.Step(terminal.StatusWarn, "Traffic split of service '"+v.Service+"' drifted: "+r.HealthMessage)
+		}
+
+		resources[i] = r
+	}
+
+	health, message := appengineutil.OverallHealth(resources)
+
+	st.Step(terminal.StatusOK, "Release status: "+health.String()+", "+message)
+
+	return &sdk.StatusReport{
+		Resources:     resources,
+		Health:        health,
+		HealthMessage: message,
+		GeneratedTime: timestamppb.Now(),
+		External:      true,
+	}, nil
+}
+
+// splitStatus reports the share of the traffic of the service the released
+// version holds: READY with all of it, PARTIAL with some of it and DOWN
+// without any. The message lists the allocations and how the traffic is
+// sharded, the report has no room for structured metadata.
+func splitStatus(
+	ctx context.Context,
+	client appengineutil.Client,
+	project string,
+	service string,
+	versionID string,
+) (*sdk.StatusReport_Resource, error) {
+	r := &sdk.StatusReport_Resource{Name: "apps/" + project + "/services/" + service}
+
+	aes, err := client.GetService(ctx, project, service)
+	if errors.Is(err, appengineutil.ErrNotFound) {
+		r.Health = sdk.StatusReport_DOWN
+		r.HealthMessage = "Service not found"
+
+		return r, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var share float64
+	if aes.Split != nil {
+		share = aes.Split.Allocations[versionID]
+	}
+
+	switch {
+	case share >= 1:
+		r.Health = sdk.StatusReport_READY
+		r.HealthMessage = "Version '" + versionID + "' receives all the traffic"
+	case share > 0:
+		r.Health = sdk.StatusReport_PARTIAL
+		r.HealthMessage = "Version '" + versionID + "' receives " + formatShare(share) + " of the traffic"
+	default:
+		r.Health = sdk.StatusReport_DOWN
+		r.HealthMessage = "Version '" + versionID + "' receives no traffic"
+	}
+
+	r.HealthMessage += " (" + splitString(aes.Split) + ")"
+
+	return r, nil
+}
+
+// splitString formats the allocations of the split, sorted by version, and
+// how the traffic is sharded.
+func splitString(split *appengine.TrafficSplit) string {
+	if split == nil {
+		return "no traffic split"
+	}
+
+	versions := make([]string, 0, len(split.Allocations))
+	for v := range split.Allocations {
+		versions = append(versions, v)
+	}
+
+	sort.Strings(versions)
+
+	allocations := make([]string, len(versions))
+	for i, v := range versions {
+		allocations[i] = v + "=" + formatShare(split.Allocations[v])
+	}
+
+	shardBy := split.ShardBy
+	if shardBy == "" {
+		shardBy = "UNSPECIFIED"
+	}
+
+	return "allocations: " + strings.Join(allocations, ", ") + "; shard_by: " + shardBy
+}
+
+func formatShare(share float64) string {
+	return strconv.FormatFloat(share*100, 'f', -1, 64) + "%"
+}
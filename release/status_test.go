@@ -0,0 +1,91 @@
+package release
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	sdk "github.com/hashicorp/waypoint-plugin-sdk/proto/gen"
+	"github.com/hashicorp/waypoint-plugin-sdk/terminal"
+	"google.golang.org/api/appengine/v1"
+
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appenginetest"
+	"github.com/sharkyze/waypoint-plugin-appengine/internal/appengineutil"
+)
+
+func TestReleaseManager_status(t *testing.T) {
+	tests := []struct {
+		name        string
+		split       *appengine.TrafficSplit
+		serviceErr  error
+		want        sdk.StatusReport_Health
+		wantMessage string
+	}{
+		{
+			name:        "all the traffic",
+			split:       &appengine.TrafficSplit{Allocations: map[string]float64{"v2": 1}, ShardBy: "IP"},
+			want:        sdk.StatusReport_READY,
+			wantMessage: "Version 'v2' receives all the traffic (allocations: v2=100%; shard_by: IP)",
+		},
+		{
+			name:        "drifted split",
+			split:       &appengine.TrafficSplit{Allocations: map[string]float64{"v1": 0.75, "v2": 0.25}},
+			want:        sdk.StatusReport_PARTIAL,
+			wantMessage: "Version 'v2' receives 25% of the traffic (allocations: v1=75%, v2=25%; shard_by: UNSPECIFIED)",
+		},
+		{
+			name:        "no traffic",
+			split:       &appengine.TrafficSplit{Allocations: map[string]float64{"v1": 1}, ShardBy: "COOKIE"},
+			want:        sdk.StatusReport_DOWN,
+			wantMessage: "Version 'v2' receives no traffic (allocations: v1=100%; shard_by: COOKIE)",
+		},
+		{
+			name:        "service deleted",
+			serviceErr:  &appengineutil.Error{Kind: appengineutil.NotFound, Message: "Service not found"},
+			want:        sdk.StatusReport_DOWN,
+			wantMessage: "Service not found",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			client := &appenginetest.MockClient{
+				GetServiceFunc: func(project, service string) (*appengine.Service, error) {
+					if tt.serviceErr != nil {
+						return nil, tt.serviceErr
+					}
+
+					return &appengine.Service{Id: service, Split: tt.split}, nil
+				},
+			}
+
+			rm := &ReleaseManager{client: client}
+			release := &Release{
+				Project:  "project",
+				Versions: []*Release_Version{{Service: "default", VersionId: "v2"}},
+			}
+
+			report, err := rm.status(ctx, terminal.NonInteractiveUI(ctx), release)
+			if err != nil {
+				t.Fatalf("status() error = %v", err)
+			}
+
+			if report.Health != tt.want {
+				t.Errorf("status() health = %v, want %v", report.Health, tt.want)
+			}
+
+			if len(report.Resources) != 1 {
+				t.Fatalf("status() resources = %v, want 1", report.Resources)
+			}
+
+			if got := report.Resources[0].HealthMessage; got != tt.wantMessage {
+				t.Errorf("status() resource message = %q, want %q", got, tt.wantMessage)
+			}
+
+			if !strings.HasSuffix(report.Resources[0].Name, "/services/default") {
+				t.Errorf("status() resource name = %q", report.Resources[0].Name)
+			}
+		})
+	}
+}